@@ -0,0 +1,160 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/limetext/backend"
+	. "github.com/limetext/text"
+)
+
+type (
+	// launchArgs are the files, folders and command given on the command
+	// line
+	launchArgs struct {
+		Files       []fileLocation `json:"files,omitempty"`
+		Folders     []string       `json:"folders,omitempty"`
+		NewWindow   bool           `json:"new_window,omitempty"`
+		Add         bool           `json:"add,omitempty"`
+		Command     string         `json:"command,omitempty"`
+		CommandArgs backend.Args   `json:"command_args,omitempty"`
+	}
+
+	// fileLocation is a file to open with an optional position to put the
+	// caret at, Line and Col start at 1 and are 0 when not given
+	fileLocation struct {
+		Path string `json:"path"`
+		Line int    `json:"line,omitempty"`
+		Col  int    `json:"col,omitempty"`
+	}
+)
+
+// parseLaunchArgs parses the positional command line arguments. Paths are
+// made absolute and sorted into files and folders. If a command is given its
+// json args may either follow its name in the same argument or be the first
+// positional argument.
+func parseLaunchArgs(args []string, newWindow, add bool, command string) (*launchArgs, error) {
+	la := &launchArgs{NewWindow: newWindow, Add: add}
+
+	if command != "" {
+		cmdArgs := ""
+		if i := strings.IndexAny(command, " \t"); i >= 0 {
+			command, cmdArgs = command[:i], strings.TrimSpace(command[i:])
+		} else if len(args) > 0 && strings.HasPrefix(args[0], "{") {
+			cmdArgs, args = args[0], args[1:]
+		}
+		la.Command = command
+		if cmdArgs != "" {
+			if err := json.Unmarshal([]byte(cmdArgs), &la.CommandArgs); err != nil {
+				return nil, fmt.Errorf("invalid args for command %s: %s", command, err)
+			}
+		}
+	}
+
+	for _, arg := range args {
+		loc := parseLocation(arg)
+		path, err := filepath.Abs(loc.Path)
+		if err != nil {
+			return nil, err
+		}
+		loc.Path = path
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			la.Folders = append(la.Folders, path)
+		} else {
+			la.Files = append(la.Files, loc)
+		}
+	}
+	return la, nil
+}
+
+// parseLocation splits the path:line:col syntax, both line and col are
+// optional. Splitting stops at a path that exists so that files with colons
+// in their name can still be opened.
+func parseLocation(arg string) fileLocation {
+	loc := fileLocation{Path: arg}
+	var nums []int
+	for len(nums) < 2 {
+		if _, err := os.Stat(loc.Path); err == nil {
+			break
+		}
+		i := strings.LastIndex(loc.Path, ":")
+		if i <= 0 {
+			break
+		}
+		n, err := strconv.Atoi(loc.Path[i+1:])
+		if err != nil || n < 1 {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		loc.Path = loc.Path[:i]
+	}
+	if len(nums) > 0 {
+		loc.Line = nums[0]
+	}
+	if len(nums) > 1 {
+		loc.Col = nums[1]
+	}
+	return loc
+}
+
+// applyLaunchArgs opens the files and folders and runs the command given on
+// the command line, returning the opened views. The window they went to is
+// raised, which is all a plain invocation does.
+func (f *frontend) applyLaunchArgs(la *launchArgs) []*backend.View {
+	ed := backend.GetEditor()
+	bw := ed.ActiveWindow()
+	if bw == nil || la.NewWindow || (len(la.Folders) > 0 && !la.Add && len(bw.Project().Folders()) > 0) {
+		bw = ed.NewWindow()
+	}
+
+	// the empty untitled view we start with isn't needed when opening files
+	var blank *backend.View
+	if vs := bw.Views(); len(vs) == 1 && vs[0].FileName() == "" && vs[0].Size() == 0 {
+		blank = vs[0]
+	}
+
+	for _, folder := range la.Folders {
+		bw.Project().AddFolder(folder)
+	}
+
+	views := make([]*backend.View, 0, len(la.Files))
+	for _, loc := range la.Files {
+		bv := bw.OpenFile(loc.Path, 0)
+		views = append(views, bv)
+		if loc.Line == 0 {
+			continue
+		}
+		col := loc.Col - 1
+		if col < 0 {
+			col = 0
+		}
+		p := bv.TextPoint(loc.Line-1, col)
+		bv.Sel().Clear()
+		bv.Sel().Add(Region{p, p})
+		f.ShowAtCenter(bv, Region{p, p})
+	}
+
+	if blank != nil && len(views) > 0 && !blank.IsDirty() {
+		blank.Close()
+	}
+
+	if la.Command != "" {
+		args := la.CommandArgs
+		if args == nil {
+			args = make(backend.Args)
+		}
+		f.RunCommandWithArgs(la.Command, args)
+	}
+	if w := f.window(bw); w != nil {
+		w.raise()
+	}
+	return views
+}
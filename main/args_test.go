@@ -0,0 +1,127 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/limetext/backend"
+)
+
+func TestParseLocation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	colon := filepath.Join(dir, "a:12")
+	if err := ioutil.WriteFile(colon, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arg string
+		exp fileLocation
+	}{
+		{"file", fileLocation{"file", 0, 0}},
+		{"file:12", fileLocation{"file", 12, 0}},
+		{"file:12:3", fileLocation{"file", 12, 3}},
+		{"dir/file.go:7", fileLocation{"dir/file.go", 7, 0}},
+		{`C:\x:3`, fileLocation{`C:\x`, 3, 0}},
+		{`C:\x:3:9`, fileLocation{`C:\x`, 3, 9}},
+		{`C:\x`, fileLocation{`C:\x`, 0, 0}},
+		{"file:0", fileLocation{"file:0", 0, 0}},
+		{"file:-1", fileLocation{"file:-1", 0, 0}},
+		{"file:12:x", fileLocation{"file:12:x", 0, 0}},
+		{"file:1:2:3", fileLocation{"file:1", 2, 3}},
+		{":12", fileLocation{":12", 0, 0}},
+		// existing paths are never split
+		{colon, fileLocation{colon, 0, 0}},
+		{colon + ":3", fileLocation{colon, 3, 0}},
+	}
+	for i, test := range tests {
+		if loc := parseLocation(test.arg); loc != test.exp {
+			t.Errorf("Test %d: Expected %+v, but got %+v", i, test.exp, loc)
+		}
+	}
+}
+
+func TestParseLaunchArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file.go")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing, err := filepath.Abs("missing.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args      []string
+		newWindow bool
+		add       bool
+		command   string
+		exp       *launchArgs
+	}{
+		{
+			nil, false, false, "",
+			&launchArgs{},
+		},
+		{
+			[]string{dir, file + ":12", "missing.go:3:4"}, true, false, "",
+			&launchArgs{
+				Files:     []fileLocation{{file, 12, 0}, {missing, 3, 4}},
+				Folders:   []string{dir},
+				NewWindow: true,
+			},
+		},
+		{
+			[]string{file}, false, true, `goto_line {"line": 3}`,
+			&launchArgs{
+				Files:       []fileLocation{{file, 0, 0}},
+				Add:         true,
+				Command:     "goto_line",
+				CommandArgs: backend.Args{"line": 3.0},
+			},
+		},
+		// the command's args may be the first positional argument
+		{
+			[]string{`{"line": 3}`, file}, false, false, "goto_line",
+			&launchArgs{
+				Files:       []fileLocation{{file, 0, 0}},
+				Command:     "goto_line",
+				CommandArgs: backend.Args{"line": 3.0},
+			},
+		},
+		{
+			[]string{file}, false, false, "save",
+			&launchArgs{
+				Files:   []fileLocation{{file, 0, 0}},
+				Command: "save",
+			},
+		},
+	}
+	for i, test := range tests {
+		la, err := parseLaunchArgs(test.args, test.newWindow, test.add, test.command)
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %s", i, err)
+		} else if !reflect.DeepEqual(la, test.exp) {
+			t.Errorf("Test %d: Expected %+v, but got %+v", i, test.exp, la)
+		}
+	}
+
+	if _, err := parseLaunchArgs(nil, false, false, "goto_line {line: 3}"); err == nil {
+		t.Error("Expected an error for invalid command args")
+	}
+}
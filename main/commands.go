@@ -0,0 +1,323 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+)
+
+type (
+	// ShowOverlayCommand shows one of the window overlays
+	ShowOverlayCommand struct {
+		backend.DefaultCommand
+		Overlay string
+		Text    string
+	}
+
+	// HideOverlayCommand hides the window's overlay
+	HideOverlayCommand struct {
+		backend.DefaultCommand
+	}
+
+	// ShowPanelCommand shows one of the window panels, or hides it again
+	// with Toggle
+	ShowPanelCommand struct {
+		backend.DefaultCommand
+		Panel  string
+		Toggle bool
+	}
+
+	// HidePanelCommand hides the window's panels
+	HidePanelCommand struct {
+		backend.DefaultCommand
+	}
+
+	// ToggleMinimapCommand shows or hides the minimap of the window's views
+	ToggleMinimapCommand struct {
+		backend.DefaultCommand
+		commandContext
+	}
+
+	// ToggleStatusBarCommand shows or hides the window's status bar
+	ToggleStatusBarCommand struct {
+		backend.DefaultCommand
+		commandContext
+	}
+
+	// ExitCommand quits the editor
+	ExitCommand struct {
+		backend.DefaultCommand
+	}
+
+	// commands initialised with their args before they are queried
+	argsIniter interface {
+		Init(args backend.Args) error
+	}
+
+	// commands that want to know the view and window they are queried for,
+	// which the backend only passes to Run
+	contexter interface {
+		setContext(bv *backend.View, bw *backend.Window)
+	}
+
+	// commandContext implements contexter for the commands embedding it
+	commandContext struct {
+		bv *backend.View
+		bw *backend.Window
+	}
+
+	// commands shown as checkbox menu items
+	checker interface {
+		IsChecked() bool
+	}
+
+	// commands that may hide their menu items
+	visibler interface {
+		IsVisible() bool
+	}
+)
+
+func (c *ShowOverlayCommand) Run(bw *backend.Window) error {
+	w := fe.window(bw)
+	if w == nil || w.Overlay == nil {
+		return nil
+	}
+	switch c.Overlay {
+	case "command_palette":
+		w.Overlay.show(&commandPalette{w: w}, "Command", c.Text)
+	case "goto":
+		w.Overlay.show(newGotoAnything(w), "Goto Anything", c.Text)
+	default:
+		return fmt.Errorf("unknown overlay: %s", c.Overlay)
+	}
+	return nil
+}
+
+func (c *HideOverlayCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil && w.Overlay != nil {
+		w.Overlay.Cancel()
+	}
+	return nil
+}
+
+func (c *ShowPanelCommand) Run(bw *backend.Window) error {
+	w := fe.window(bw)
+	if w == nil {
+		return nil
+	}
+	switch c.Panel {
+	case "find", "incremental_find":
+		w.FindInFiles.Hide()
+		w.Find.show(false, c.Toggle)
+	case "replace":
+		w.FindInFiles.Hide()
+		w.Find.show(true, c.Toggle)
+	case "find_in_files":
+		w.Find.Hide()
+		if c.Toggle && w.FindInFiles.Visible {
+			w.FindInFiles.Hide()
+		} else {
+			w.FindInFiles.show()
+		}
+	case "console":
+		w.setVisible(&w.ConsoleVisible, !c.Toggle || !w.ConsoleVisible)
+	default:
+		return fmt.Errorf("unknown panel: %s", c.Panel)
+	}
+	return nil
+}
+
+func (c *HidePanelCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil {
+		w.Find.Hide()
+		w.FindInFiles.Hide()
+		w.setVisible(&w.ConsoleVisible, false)
+	}
+	return nil
+}
+
+// activeWindow returns the glue of the active window or nil
+func activeWindow() *window {
+	return fe.window(backend.GetEditor().ActiveWindow())
+}
+
+func (c *commandContext) setContext(bv *backend.View, bw *backend.Window) {
+	c.bv, c.bw = bv, bw
+}
+
+// window returns the glue of the window the command is queried for, or of
+// the active window if it wasn't given
+func (c *commandContext) window() *window {
+	if c.bw != nil {
+		return fe.window(c.bw)
+	}
+	return activeWindow()
+}
+
+func (c *ToggleMinimapCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil {
+		w.setVisible(&w.MinimapVisible, !w.MinimapVisible)
+	}
+	return nil
+}
+
+func (c *ToggleMinimapCommand) IsChecked() bool {
+	w := c.window()
+	return w != nil && w.MinimapVisible
+}
+
+func (c *ToggleStatusBarCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil {
+		w.setVisible(&w.StatusBarVisible, !w.StatusBarVisible)
+	}
+	return nil
+}
+
+func (c *ToggleStatusBarCommand) IsChecked() bool {
+	w := c.window()
+	return w != nil && w.StatusBarVisible
+}
+
+func (c *ExitCommand) Run() error {
+	return fe.Quit()
+}
+
+// lookupCommand returns the registered command called name or nil
+func lookupCommand(name string) backend.Command {
+	return backend.GetEditor().CommandHandler().Commands()[name]
+}
+
+// commandNames returns the sorted names of all registered commands
+func commandNames() []string {
+	cmds := backend.GetEditor().CommandHandler().Commands()
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// copyCommand returns a shallow copy of the registered command cmd, which can
+// be initialised without changing what other users of cmd see
+func copyCommand(cmd backend.Command) backend.Command {
+	v := reflect.ValueOf(cmd)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return cmd
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	if ret, ok := c.Interface().(backend.Command); ok {
+		return ret
+	}
+	return cmd
+}
+
+// initCommand returns a copy of the registered command called name
+// initialised with args and the view and window it's queried for, or nil if
+// there is no such command. ok is false if the command rejected the args.
+// The active window and its active view are used for a nil bw and bv.
+func initCommand(name string, args backend.Args, bv *backend.View, bw *backend.Window) (cmd backend.Command, ok bool) {
+	cmd = lookupCommand(name)
+	if cmd == nil {
+		return nil, true
+	}
+	cmd = copyCommand(cmd)
+	if c, isContexter := cmd.(contexter); isContexter {
+		if bw == nil && bv != nil {
+			bw = bv.Window()
+		}
+		if bw == nil {
+			bw = backend.GetEditor().ActiveWindow()
+		}
+		if bv == nil && bw != nil {
+			bv = bw.ActiveView()
+		}
+		c.setContext(bv, bw)
+	}
+	if i, isIniter := cmd.(argsIniter); isIniter {
+		if err := i.Init(args); err != nil {
+			return cmd, false
+		}
+	}
+	return cmd, true
+}
+
+// commandEnabled reports whether the command is enabled with args in bv and
+// bw, see initCommand. Unknown commands are considered enabled as they might
+// be provided by a package that isn't loaded yet.
+func commandEnabled(name string, args backend.Args, bv *backend.View, bw *backend.Window) bool {
+	cmd, ok := initCommand(name, args, bv, bw)
+	if cmd == nil || !ok {
+		return ok
+	}
+	return cmd.IsEnabled()
+}
+
+// commandChecked reports whether the command with args should be shown as
+// checked in bv and bw, for commands toggling something
+func commandChecked(name string, args backend.Args, bv *backend.View, bw *backend.Window) bool {
+	cmd, ok := initCommand(name, args, bv, bw)
+	if c, isChecker := cmd.(checker); ok && isChecker {
+		return c.IsChecked()
+	}
+	return false
+}
+
+// commandVisible reports whether the command with args should be shown in
+// menus of bv and bw
+func commandVisible(name string, args backend.Args, bv *backend.View, bw *backend.Window) bool {
+	cmd, ok := initCommand(name, args, bv, bw)
+	if v, isVisibler := cmd.(visibler); ok && isVisibler {
+		return v.IsVisible()
+	}
+	return true
+}
+
+// commandCaption turns a command name like "new_file" into "New File"
+func commandCaption(name string) string {
+	words := strings.Split(name, "_")
+	for i, w := range words {
+		if w != "" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func register(cmds []backend.Command) {
+	ch := backend.GetEditor().CommandHandler()
+	for _, cmd := range cmds {
+		if err := ch.RegisterWithDefault(cmd); err != nil {
+			log.Error("Failed to register command: %s", err)
+		}
+	}
+}
+
+func init() {
+	register([]backend.Command{
+		&ShowOverlayCommand{},
+		&HideOverlayCommand{},
+		&ShowPanelCommand{},
+		&HidePanelCommand{},
+		&ToggleMinimapCommand{},
+		&ToggleStatusBarCommand{},
+		&ExitCommand{},
+		&SetLayoutCommand{},
+		&FocusGroupCommand{},
+		&MoveToGroupCommand{},
+		&NotifyCommand{},
+		&DumpNotificationsCommand{},
+		&FindPanelNextCommand{},
+		&FindPanelPrevCommand{},
+		&FindPanelAllCommand{},
+	})
+}
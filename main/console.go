@@ -0,0 +1,37 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import "github.com/limetext/backend/log"
+
+// the number of console inputs remembered
+const consoleHistoryLen = 100
+
+// ConsoleEval is called from QML with the code entered in the console input
+func (f *frontend) ConsoleEval(code string) {
+	if code == "" {
+		return
+	}
+	f.consoleHistory.add(code)
+	go f.consoleEval(code)
+}
+
+// ConsoleHistory is called from QML to get the i-th most recent console
+// input, or an empty string if there are fewer
+func (f *frontend) ConsoleHistory(i int) string {
+	entries := f.consoleHistory.list()
+	if i < 0 || i >= len(entries) {
+		return ""
+	}
+	return entries[i]
+}
+
+// consoleEval runs code with console_eval of sublime_plugin.py, which echoes
+// it into the console along with its result or traceback
+func (f *frontend) consoleEval(code string) {
+	if err := callPlugin("console_eval", code); err != nil {
+		log.Error("Couldn't evaluate %q: %s", code, err)
+	}
+}
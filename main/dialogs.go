@@ -0,0 +1,361 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+	"github.com/limetext/qml-go"
+)
+
+const (
+	// how long a modal dialog waits, first for the dialogs before it and
+	// then for the user, before it's treated as cancelled
+	dialogTimeout = 10 * time.Minute
+
+	// the result of dialogs that were cancelled or timed out
+	dialogRejected = "rejected"
+
+	statusMessageDuration = 5 * time.Second
+	defaultToastDuration  = 5 * time.Second
+	// the number of notifications kept for dump_notifications
+	notificationHistoryLen = 100
+)
+
+// severities of notifications
+const (
+	severityInfo    = "info"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+type (
+	// dialogs routes the results of modal dialogs back to the goroutines
+	// waiting for them. Each request gets an id which QML passes back
+	// along with the result.
+	dialogs struct {
+		lock    sync.Mutex
+		lastId  int
+		pending map[int]chan string
+	}
+
+	// expirer runs functions after a while using a single timer, for
+	// status messages and toasts
+	expirer struct {
+		lock   sync.Mutex
+		timer  *time.Timer
+		lastId int
+		items  map[int]expiring
+	}
+
+	expiring struct {
+		at time.Time
+		fn func()
+	}
+
+	// notification is a non modal message shown as a toast
+	notification struct {
+		Text     string
+		Severity string
+		id       int
+		time     time.Time
+	}
+
+	// NotifyCommand shows a toast notification in the active window
+	NotifyCommand struct {
+		backend.DefaultCommand
+		Message  string
+		Severity string
+		// in seconds, the default is used if it isn't positive
+		Duration float64
+	}
+
+	// DumpNotificationsCommand writes the recent notifications to the
+	// console and shows it
+	DumpNotificationsCommand struct {
+		backend.DefaultCommand
+	}
+)
+
+// add returns the id of a new request and the channel its result is sent on
+func (d *dialogs) add() (int, chan string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.pending == nil {
+		d.pending = make(map[int]chan string)
+	}
+	d.lastId++
+	c := make(chan string, 1)
+	d.pending[d.lastId] = c
+	return d.lastId, c
+}
+
+// done delivers the result of the request id, results of requests nobody
+// waits for anymore are dropped
+func (d *dialogs) done(id int, result string) {
+	d.lock.Lock()
+	c := d.pending[id]
+	delete(d.pending, id)
+	d.lock.Unlock()
+	if c == nil {
+		log.Fine("Dropping result %q of dialog %d", result, id)
+		return
+	}
+	c <- result
+}
+
+func (d *dialogs) forget(id int) {
+	d.lock.Lock()
+	delete(d.pending, id)
+	d.lock.Unlock()
+}
+
+// runDialog opens the qml dialog called name in the active window once the
+// dialogs before it were closed and waits for its result. setup prepares the
+// dialog before it's opened. The returned object is nil if there was no
+// window to show the dialog in.
+func (f *frontend) runDialog(name string, setup func(obj qml.Object)) (qml.Object, string) {
+	w := f.window(backend.GetEditor().ActiveWindow())
+	if w == nil || w.qw == nil {
+		return nil, dialogRejected
+	}
+
+	if !w.queueDialog() {
+		log.Warn("Timed out waiting to show %s", name)
+		return nil, dialogRejected
+	}
+	defer w.dialogDone()
+
+	id, result := f.dialogs.add()
+	obj := w.qw.ObjectByName(name)
+	if setup != nil {
+		setup(obj)
+	}
+	obj.Set("requestId", id)
+	obj.Call("open")
+
+	select {
+	case res := <-result:
+		log.Fine("returning %s from dialog %d", res, id)
+		return obj, res
+	case <-time.After(dialogTimeout):
+		log.Warn("Timed out waiting for %s", name)
+		f.dialogs.forget(id)
+		obj.Call("close")
+		return obj, dialogRejected
+	}
+}
+
+// queueDialog waits until the dialogs of w opened before were closed. It
+// returns false if that took too long, otherwise dialogDone must be called
+// once the dialog is closed.
+func (w *window) queueDialog() bool {
+	select {
+	case w.dialogQueue <- struct{}{}:
+		return true
+	case <-time.After(dialogTimeout):
+		return false
+	}
+}
+
+func (w *window) dialogDone() {
+	<-w.dialogQueue
+}
+
+// PromptClosed is called from QML with the result of the dialog request id
+func (f *frontend) PromptClosed(id int, result string) {
+	f.dialogs.done(id, result)
+}
+
+// SaveDialogFailed is called from QML when the save dialog suggesting file
+// names couldn't be loaded from source, as with older Qt versions
+func (f *frontend) SaveDialogFailed(source string) {
+	log.Warn("Couldn't load %s, saving uses the file dialog instead", source)
+}
+
+// add runs fn after d and returns an id to cancel it with
+func (e *expirer) add(d time.Duration, fn func()) int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.items == nil {
+		e.items = make(map[int]expiring)
+	}
+	e.lastId++
+	e.items[e.lastId] = expiring{time.Now().Add(d), fn}
+	e.arm()
+	return e.lastId
+}
+
+func (e *expirer) cancel(id int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.items, id)
+	e.arm()
+}
+
+// arm sets the timer to the earliest item. The caller holds the lock.
+func (e *expirer) arm() {
+	var next time.Time
+	for _, it := range e.items {
+		if next.IsZero() || it.at.Before(next) {
+			next = it.at
+		}
+	}
+	if next.IsZero() {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		return
+	}
+	d := next.Sub(time.Now())
+	if e.timer == nil {
+		e.timer = time.AfterFunc(d, e.fire)
+	} else {
+		e.timer.Reset(d)
+	}
+}
+
+// fire runs the functions of all expired items
+func (e *expirer) fire() {
+	e.lock.Lock()
+	now := time.Now()
+	var fns []func()
+	for id, it := range e.items {
+		if !it.at.After(now) {
+			fns = append(fns, it.fn)
+			delete(e.items, id)
+		}
+	}
+	e.arm()
+	e.lock.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// StatusMessage shows msg in the status bar of the active window for a
+// while, until another message replaces it
+func (f *frontend) StatusMessage(msg string) {
+	w := f.window(backend.GetEditor().ActiveWindow())
+	if w == nil {
+		return
+	}
+	w.notifyLock.Lock()
+	defer w.notifyLock.Unlock()
+	w.Status = msg
+	f.qmlChanged(w, &w.Status)
+	f.expirer.cancel(w.statusExpiry)
+	w.statusExpiry = f.expirer.add(statusMessageDuration, func() {
+		w.notifyLock.Lock()
+		defer w.notifyLock.Unlock()
+		if w.Status == msg {
+			w.Status = ""
+			f.qmlChanged(w, &w.Status)
+		}
+	})
+}
+
+// notify shows a toast in the active window for d, or the default duration
+// if d isn't positive, and keeps it in the notification history
+func (f *frontend) notify(severity, msg string, d time.Duration) {
+	switch severity {
+	case severityError:
+		log.Error(msg)
+	case severityWarning:
+		log.Warn(msg)
+	default:
+		severity = severityInfo
+		log.Info(msg)
+	}
+	if d <= 0 {
+		d = defaultToastDuration
+	}
+
+	n := &notification{Text: msg, Severity: severity, time: time.Now()}
+	f.lock.Lock()
+	f.notifications = append(f.notifications, n)
+	if len(f.notifications) > notificationHistoryLen {
+		f.notifications = f.notifications[len(f.notifications)-notificationHistoryLen:]
+	}
+	f.lock.Unlock()
+
+	w := f.window(backend.GetEditor().ActiveWindow())
+	if w == nil {
+		return
+	}
+	w.notifyLock.Lock()
+	n.id = f.expirer.add(d, func() { w.dismissToast(n) })
+	w.toasts = append(w.toasts, n)
+	w.toastsChanged()
+	w.notifyLock.Unlock()
+}
+
+// toastsChanged tells QML about changed toasts. The caller holds notifyLock.
+func (w *window) toastsChanged() {
+	w.ToastsLen = len(w.toasts)
+	w.ToastsVersion++
+	fe.qmlChanged(w, &w.ToastsLen)
+	fe.qmlChanged(w, &w.ToastsVersion)
+}
+
+func (w *window) dismissToast(n *notification) {
+	w.notifyLock.Lock()
+	defer w.notifyLock.Unlock()
+	for i, t := range w.toasts {
+		if t == n {
+			w.toasts = append(w.toasts[:i], w.toasts[i+1:]...)
+			w.toastsChanged()
+			return
+		}
+	}
+}
+
+// Toast is called from QML to get the i-th toast shown
+func (w *window) Toast(i int) *notification {
+	w.notifyLock.Lock()
+	defer w.notifyLock.Unlock()
+	if i < 0 || i >= len(w.toasts) {
+		return nil
+	}
+	return w.toasts[i]
+}
+
+// DismissToast is called from QML when the i-th toast is clicked away
+func (w *window) DismissToast(i int) {
+	if n := w.Toast(i); n != nil {
+		fe.expirer.cancel(n.id)
+		w.dismissToast(n)
+	}
+}
+
+func (c *NotifyCommand) Run() error {
+	fe.notify(c.Severity, c.Message, time.Duration(c.Duration*float64(time.Second)))
+	return nil
+}
+
+func (c *DumpNotificationsCommand) Run(bw *backend.Window) error {
+	fe.lock.Lock()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d notifications:\n", len(fe.notifications))
+	for _, n := range fe.notifications {
+		fmt.Fprintf(&buf, "%s [%s] %s\n", n.time.Format("15:04:05"), n.Severity, n.Text)
+	}
+	fe.lock.Unlock()
+
+	con := backend.GetEditor().Console()
+	e := con.BeginEdit()
+	con.Insert(e, con.Size(), buf.String())
+	con.EndEdit(e)
+	if w := fe.window(bw); w != nil {
+		w.setVisible(&w.ConsoleVisible, true)
+	}
+	return nil
+}
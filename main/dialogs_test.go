@@ -0,0 +1,85 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDialogsRouteResults(t *testing.T) {
+	var d dialogs
+	id1, c1 := d.add()
+	id2, c2 := d.add()
+	if id1 == id2 {
+		t.Fatalf("Expected different ids, got %d twice", id1)
+	}
+
+	d.done(id2, "second")
+	d.done(id1, "first")
+	if res := <-c1; res != "first" {
+		t.Errorf("Expected first, got %s", res)
+	}
+	if res := <-c2; res != "second" {
+		t.Errorf("Expected second, got %s", res)
+	}
+
+	// results of forgotten and unknown requests are dropped
+	id3, c3 := d.add()
+	d.forget(id3)
+	d.done(id3, "late")
+	d.done(42, "unknown")
+	select {
+	case res := <-c3:
+		t.Errorf("Expected no result, got %s", res)
+	default:
+	}
+}
+
+func TestExpirer(t *testing.T) {
+	var e expirer
+	fired := make(chan int, 3)
+	e.add(30*time.Millisecond, func() { fired <- 2 })
+	e.add(10*time.Millisecond, func() { fired <- 1 })
+	id := e.add(20*time.Millisecond, func() { fired <- 3 })
+	e.cancel(id)
+
+	for _, exp := range []int{1, 2} {
+		select {
+		case got := <-fired:
+			if got != exp {
+				t.Errorf("Expected %d to fire, got %d", exp, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %d", exp)
+		}
+	}
+	select {
+	case got := <-fired:
+		t.Errorf("Expected nothing else to fire, got %d", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestYesNoCancelResult(t *testing.T) {
+	tests := []struct {
+		res string
+		exp int
+	}{
+		{"yes", dialogYes},
+		{"no", dialogNo},
+		{"rejected", dialogCancel},
+		{"", dialogCancel},
+	}
+	for i, test := range tests {
+		if r := yesNoCancelResult(test.res); r != test.exp {
+			t.Errorf("Test %d: Expected %q to be %d, but got %d", i, test.res, test.exp, r)
+		}
+	}
+	// sublime's DIALOG_CANCEL, DIALOG_YES and DIALOG_NO
+	if dialogCancel != 0 || dialogYes != 1 || dialogNo != 2 {
+		t.Errorf("Expected 0, 1, 2, got %d, %d, %d", dialogCancel, dialogYes, dialogNo)
+	}
+}
@@ -0,0 +1,497 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+	. "github.com/limetext/text"
+)
+
+const (
+	// lines shown before and after each matching line
+	findContextLines = 2
+	// files with a NUL byte in their first bytes are taken as binary
+	binarySniffLen = 8000
+)
+
+var errSearchCancelled = errors.New("search cancelled")
+
+type (
+	// A helper glue structure holding the state of a window's find in files
+	// panel, searches stream their results into a read only "Find Results"
+	// view
+	findInFiles struct {
+		Visible       bool
+		Pattern       string
+		Where         string
+		Regex         bool
+		CaseSensitive bool
+		WholeWord     bool
+		Searching     bool
+		Status        string
+
+		w      *window
+		lock   sync.Mutex
+		cancel chan struct{}
+		// serialises writing to results views, so that searches only write
+		// while their results are the current ones of the view
+		writeLock sync.Mutex
+		// the view results are written to, reused by later searches
+		view    *backend.View
+		results map[*backend.View]*findResults
+	}
+
+	// findResults maps the rows of a results view to the locations they
+	// show
+	findResults struct {
+		lock      sync.Mutex
+		locations map[int]fileLocation
+	}
+
+	// fileMatches are the matching lines of a file along with their context
+	fileMatches struct {
+		path    string
+		lines   []resultLine
+		matches int
+	}
+
+	resultLine struct {
+		num   int // 0 based, -1 for the gap between non adjacent lines
+		col   int // column of the first match, -1 for context lines
+		text  string
+		match bool
+	}
+)
+
+func newFindInFiles(w *window) *findInFiles {
+	return &findInFiles{
+		w:       w,
+		results: make(map[*backend.View]*findResults),
+	}
+}
+
+func (p *findInFiles) show() {
+	p.Visible = true
+	if p.Where == "" {
+		p.Where = "<project>"
+	}
+	fe.qmlChanged(p, &p.Where)
+	fe.qmlChanged(p, &p.Visible)
+}
+
+// Hide is called from QML to close the panel, a running search carries on
+func (p *findInFiles) Hide() {
+	p.Visible = false
+	fe.qmlChanged(p, &p.Visible)
+}
+
+// SetOption is called from QML when one of the option toggles is clicked
+func (p *findInFiles) SetOption(name string, on bool) {
+	switch name {
+	case "regex":
+		p.Regex = on
+	case "case_sensitive":
+		p.CaseSensitive = on
+	case "whole_word":
+		p.WholeWord = on
+	}
+}
+
+// Find is called from QML to search for pattern in the files where refers to
+func (p *findInFiles) Find(pattern, where string) {
+	p.Pattern, p.Where = pattern, where
+	if pattern == "" {
+		return
+	}
+	re, err := compileSearch(pattern, searchOptions{
+		Regex:         p.Regex,
+		CaseSensitive: p.CaseSensitive,
+		WholeWord:     p.WholeWord,
+	})
+	if err != nil {
+		p.setStatus(err.Error())
+		return
+	}
+
+	p.Cancel()
+	paths, include, exclude := parseWhere(where, p.w.bw.Project().Folders())
+	if len(paths) == 0 {
+		p.setStatus("No folders to search in")
+		return
+	}
+	settings := p.w.bw.Settings()
+	exclude = append(exclude, stringsSetting(settings, "file_exclude_patterns", defaultFileExcludePatterns)...)
+	folderEx := stringsSetting(settings, "folder_exclude_patterns", defaultFolderExcludePatterns)
+
+	bv := p.resultsView()
+	res := &findResults{locations: make(map[int]fileLocation)}
+	cancel := make(chan struct{})
+
+	// the new results are installed before the view is emptied, so that a
+	// search still running can't write into it anymore
+	p.writeLock.Lock()
+	p.lock.Lock()
+	p.cancel = cancel
+	p.results[bv] = res
+	p.lock.Unlock()
+	e := bv.BeginEdit()
+	bv.Erase(e, Region{0, bv.Size()})
+	bv.EndEdit(e)
+	bv.Sel().Clear()
+	appendText(bv, fmt.Sprintf("Searching for %q in %s\n\n", pattern, where))
+	p.writeLock.Unlock()
+
+	p.Searching = true
+	fe.qmlChanged(p, &p.Searching)
+	p.setStatus("Searching...")
+
+	go p.search(re, paths, include, exclude, folderEx, bv, res, cancel)
+}
+
+// Cancel is called from QML to stop the running search
+func (p *findInFiles) Cancel() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.cancel != nil {
+		close(p.cancel)
+		p.cancel = nil
+	}
+}
+
+func (p *findInFiles) setStatus(status string) {
+	p.Status = status
+	fe.qmlChanged(p, &p.Status)
+}
+
+// resultsView returns the results view of the window, creating it if
+// needed
+func (p *findInFiles) resultsView() *backend.View {
+	if bv := p.view; bv != nil && p.w.view(bv) != nil {
+		fe.activate(bv)
+		return bv
+	}
+	bv := p.w.bw.NewFile()
+	bv.SetName("Find Results")
+	bv.SetScratch(true)
+	bv.Settings().Set("read_only", true)
+	p.view = bv
+	return bv
+}
+
+// forget drops and returns the results of bv, which was closed or moved to
+// another window
+func (p *findInFiles) forget(bv *backend.View) *findResults {
+	p.lock.Lock()
+	res := p.results[bv]
+	delete(p.results, bv)
+	p.lock.Unlock()
+	if p.view == bv {
+		p.view = nil
+	}
+	return res
+}
+
+// adopt takes the results view bv over from another window
+func (p *findInFiles) adopt(bv *backend.View, res *findResults) {
+	p.lock.Lock()
+	p.results[bv] = res
+	p.lock.Unlock()
+}
+
+// parseWhere splits the comma separated where field of the panel into the
+// paths to search and the include and exclude file name patterns. Patterns
+// starting with a '-' exclude files, "<project>" stands for the window's
+// project folders which are also searched if no path is given.
+func parseWhere(where string, project []string) (paths, include, exclude []string) {
+	for _, it := range strings.Split(where, ",") {
+		it = strings.TrimSpace(it)
+		switch {
+		case it == "":
+		case it == "<project>":
+			paths = append(paths, project...)
+		case strings.HasPrefix(it, "-"):
+			exclude = append(exclude, it[1:])
+		case strings.ContainsAny(it, "*?["):
+			include = append(include, it)
+		default:
+			paths = append(paths, it)
+		}
+	}
+	if len(paths) == 0 {
+		paths = project
+	}
+	return
+}
+
+// search runs the search over the files under paths, appending the results
+// to bv as they come in
+func (p *findInFiles) search(re *regexp.Regexp, paths, include, exclude, folderEx []string, bv *backend.View, res *findResults, cancel chan struct{}) {
+	files := make(chan string)
+	found := make(chan *fileMatches)
+
+	go func() {
+		defer close(files)
+		for _, path := range paths {
+			err := filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+				if err != nil {
+					log.Fine("Skipping %s while searching: %s", path, err)
+					return nil
+				}
+				name := fi.Name()
+				if fi.IsDir() {
+					if matchesAny(name, folderEx) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if matchesAny(name, exclude) || (len(include) > 0 && !matchesAny(name, include)) {
+					return nil
+				}
+				select {
+				case files <- path:
+					return nil
+				case <-cancel:
+					return errSearchCancelled
+				}
+			})
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range files {
+				m := searchFile(re, path)
+				if m == nil {
+					continue
+				}
+				select {
+				case found <- m:
+				case <-cancel:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	matches, nfiles := 0, 0
+	for m := range found {
+		matches += m.matches
+		nfiles++
+		p.write(bv, res, func() { p.appendMatches(bv, res, m) })
+	}
+
+	cancelled := false
+	select {
+	case <-cancel:
+		cancelled = true
+	default:
+	}
+	p.lock.Lock()
+	if p.cancel == cancel {
+		p.cancel = nil
+	}
+	p.lock.Unlock()
+
+	var status string
+	switch nfiles {
+	case 0:
+		status = matchCount(0)
+	case 1:
+		status = matchCount(matches) + " in 1 file"
+	default:
+		status = fmt.Sprintf("%s across %d files", matchCount(matches), nfiles)
+	}
+	if cancelled {
+		status = "Search cancelled, " + status
+	}
+	if !p.write(bv, res, func() { appendText(bv, status+"\n") }) {
+		// a newer search took over the results view
+		return
+	}
+	p.Searching = false
+	fe.qmlChanged(p, &p.Searching)
+	p.setStatus(status)
+}
+
+// current reports whether res are the results of the latest search into bv
+func (p *findInFiles) current(bv *backend.View, res *findResults) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.results[bv] == res
+}
+
+// write calls fn to write to bv if res are still its current results,
+// reporting whether it did
+func (p *findInFiles) write(bv *backend.View, res *findResults, fn func()) bool {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+	if !p.current(bv, res) {
+		return false
+	}
+	fn()
+	return true
+}
+
+// searchFile returns the lines of the file at path matching re with their
+// context, or nil if there are none or the file looks binary
+func searchFile(re *regexp.Regexp, path string) *fileMatches {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fine("Couldn't search %s: %s", path, err)
+		return nil
+	}
+	sniff := data
+	if len(sniff) > binarySniffLen {
+		sniff = sniff[:binarySniffLen]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	m := &fileMatches{path: path}
+	last := -1 // last line added
+	for i, line := range lines {
+		loc := re.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		m.matches++
+
+		first := i - findContextLines
+		if first <= last {
+			first = last + 1
+		} else if last >= 0 {
+			m.lines = append(m.lines, resultLine{num: -1})
+		}
+		if first < 0 {
+			first = 0
+		}
+		for j := first; j < i; j++ {
+			m.lines = append(m.lines, resultLine{num: j, col: -1, text: lines[j]})
+		}
+		col := utf8.RuneCountInString(line[:loc[0]])
+		m.lines = append(m.lines, resultLine{num: i, col: col, text: line, match: true})
+		last = i
+
+		// the context after the match, unless the next lines match too
+		for j := i + 1; j <= i+findContextLines && j < len(lines); j++ {
+			if re.MatchString(lines[j]) {
+				break
+			}
+			m.lines = append(m.lines, resultLine{num: j, col: -1, text: lines[j]})
+			last = j
+		}
+	}
+	if m.matches == 0 {
+		return nil
+	}
+	return m
+}
+
+// appendMatches adds the matches of a file to the results view and records
+// where its rows lead to
+func (p *findInFiles) appendMatches(bv *backend.View, res *findResults, m *fileMatches) {
+	var buf bytes.Buffer
+	locs := []fileLocation{{Path: m.path}}
+	fmt.Fprintf(&buf, "%s:\n", m.path)
+	for _, l := range m.lines {
+		switch {
+		case l.num < 0:
+			buf.WriteString("  ..\n")
+			locs = append(locs, fileLocation{})
+			continue
+		case l.match:
+			fmt.Fprintf(&buf, "%5d: %s\n", l.num+1, l.text)
+		default:
+			fmt.Fprintf(&buf, "%5d  %s\n", l.num+1, l.text)
+		}
+		col := l.col
+		if col < 0 {
+			col = 0
+		}
+		locs = append(locs, fileLocation{Path: m.path, Line: l.num + 1, Col: col + 1})
+	}
+	buf.WriteString("\n")
+
+	row := appendText(bv, buf.String())
+	res.lock.Lock()
+	for i, loc := range locs {
+		if loc.Path != "" {
+			res.locations[row+i] = loc
+		}
+	}
+	res.lock.Unlock()
+}
+
+// appendText adds text at the end of bv and returns the row it starts at
+func appendText(bv *backend.View, text string) int {
+	row, _ := bv.RowCol(bv.Size())
+	e := bv.BeginEdit()
+	bv.Insert(e, bv.Size(), text)
+	bv.EndEdit(e)
+	return row
+}
+
+// open opens the location shown at row of the results view bv. Returns
+// false if bv isn't a results view or there is nothing to open at row.
+func (p *findInFiles) open(bv *backend.View, row int) bool {
+	p.lock.Lock()
+	res := p.results[bv]
+	p.lock.Unlock()
+	if res == nil {
+		return false
+	}
+	res.lock.Lock()
+	loc, ok := res.locations[row]
+	res.lock.Unlock()
+	if !ok {
+		return false
+	}
+
+	target := openView(p.w.bw, loc.Path)
+	if loc.Line > 0 {
+		pt := target.TextPoint(loc.Line-1, loc.Col-1)
+		target.Sel().Clear()
+		target.Sel().Add(Region{pt, pt})
+		fe.ShowAtCenter(target, Region{pt, pt})
+	}
+	return true
+}
+
+// openView returns the view of bw showing the file at path, opening the file
+// if there is none
+func openView(bw *backend.Window, path string) *backend.View {
+	for _, bv := range bw.Views() {
+		if bv.FileName() == path {
+			fe.activate(bv)
+			return bv
+		}
+	}
+	return bw.OpenFile(path, 0)
+}
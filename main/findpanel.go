@@ -0,0 +1,454 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/keys"
+	"github.com/limetext/backend/log"
+	"github.com/limetext/loaders"
+	. "github.com/limetext/text"
+)
+
+// colours of the chunks matching the find panel's pattern
+const (
+	findHighlightForeground = "000000"
+	findHighlightBackground = "FFE792"
+)
+
+// findKeymap binds the keys sublime uses for finding to the panel's
+// commands. The packages bind them to the backend's find_next, which
+// doesn't know about the panel.
+const findKeymap = `[
+	{"keys": ["f3"], "command": "find_panel_next"},
+	{"keys": ["shift+f3"], "command": "find_panel_prev"}
+]`
+
+type (
+	// FindPanelNextCommand selects the next match of the find panel's
+	// pattern after the caret
+	FindPanelNextCommand struct {
+		backend.DefaultCommand
+	}
+
+	// FindPanelPrevCommand selects the match of the find panel's pattern
+	// before the caret
+	FindPanelPrevCommand struct {
+		backend.DefaultCommand
+	}
+
+	// FindPanelAllCommand selects all matches of the find panel's pattern
+	FindPanelAllCommand struct {
+		backend.DefaultCommand
+	}
+)
+
+// loadFindKeymap adds findKeymap to the editor's key bindings, after the
+// packages' so that it takes precedence
+func loadFindKeymap() {
+	var kb keys.KeyBindings
+	if err := loaders.LoadJSON([]byte(findKeymap), &kb); err != nil {
+		log.Error("Couldn't load the find key bindings: %s", err)
+		return
+	}
+	backend.GetEditor().KeyBindings().Merge(&kb)
+}
+
+// A helper glue structure holding the state of a window's find and replace
+// panel. All matches of the pattern in the active view are highlighted while
+// the panel is shown.
+type findPanel struct {
+	Visible        bool
+	ReplaceVisible bool
+	Pattern        string
+	Replacement    string
+	Regex          bool
+	CaseSensitive  bool
+	WholeWord      bool
+	InSelection    bool
+	Wrap           bool
+	Status         string
+
+	w    *window
+	lock sync.Mutex
+	// the view the matches were searched in, its text and the matches
+	// themselves along with the byte offsets of their submatches in text
+	bv      *backend.View
+	re      *regexp.Regexp
+	text    string
+	matches []Region
+	locs    [][]int
+	// the selection searched in when InSelection is set
+	scope []Region
+}
+
+func newFindPanel(w *window) *findPanel {
+	return &findPanel{w: w, Wrap: true}
+}
+
+func (p *findPanel) options() searchOptions {
+	return searchOptions{
+		Regex:         p.Regex,
+		CaseSensitive: p.CaseSensitive,
+		WholeWord:     p.WholeWord,
+		InSelection:   p.InSelection,
+		Wrap:          p.Wrap,
+	}
+}
+
+// show opens the panel, with the replace field if replace is set. When
+// toggle is set and the panel is already shown the same way it's hidden
+// instead.
+func (p *findPanel) show(replace, toggle bool) {
+	if toggle && p.Visible && p.ReplaceVisible == replace {
+		p.Hide()
+		return
+	}
+	p.lock.Lock()
+	if bv := p.w.bw.ActiveView(); bv != nil {
+		rs := bv.Sel().Regions()
+		// search for the selected text, unless it's a multi line selection
+		// which is more likely meant to be searched in
+		if len(rs) == 1 && !rs[0].Empty() {
+			if text := bv.Substr(rs[0]); !strings.Contains(text, "\n") {
+				p.Pattern = text
+				if p.Regex {
+					p.Pattern = regexp.QuoteMeta(text)
+				}
+			}
+		}
+		p.scope = rs
+	}
+	p.Visible = true
+	p.ReplaceVisible = replace
+	p.lock.Unlock()
+
+	p.update()
+	fe.qmlChanged(p, &p.Pattern)
+	fe.qmlChanged(p, &p.ReplaceVisible)
+	fe.qmlChanged(p, &p.Visible)
+}
+
+// Hide is called from QML to close the panel, which also removes the
+// highlighted matches
+func (p *findPanel) Hide() {
+	p.lock.Lock()
+	p.Visible = false
+	p.setTarget(nil)
+	p.lock.Unlock()
+	fe.qmlChanged(p, &p.Visible)
+}
+
+// SetPattern is called from QML when the text of the find field changes
+func (p *findPanel) SetPattern(pattern string) {
+	if pattern == p.Pattern {
+		return
+	}
+	p.Pattern = pattern
+	p.update()
+}
+
+// SetReplacement is called from QML when the text of the replace field
+// changes
+func (p *findPanel) SetReplacement(replacement string) {
+	p.Replacement = replacement
+}
+
+// SetOption is called from QML when one of the option toggles is clicked
+func (p *findPanel) SetOption(name string, on bool) {
+	switch name {
+	case "regex":
+		p.Regex = on
+	case "case_sensitive":
+		p.CaseSensitive = on
+	case "whole_word":
+		p.WholeWord = on
+	case "in_selection":
+		p.InSelection = on
+		if bv := p.w.bw.ActiveView(); on && bv != nil {
+			p.scope = bv.Sel().Regions()
+		}
+	case "wrap":
+		p.Wrap = on
+	default:
+		return
+	}
+	p.update()
+}
+
+// setTarget moves the highlighted matches to bv, which may be nil. The
+// caller must hold p.lock.
+func (p *findPanel) setTarget(bv *backend.View) {
+	if p.bv == bv {
+		return
+	}
+	if v := fe.view(p.bv); v != nil {
+		v.setMatches(nil)
+	}
+	p.bv = bv
+	p.re = nil
+	p.text = ""
+	p.matches = nil
+	p.locs = nil
+}
+
+// update searches the active view again, e.g. after the pattern, the options
+// or the buffer changed
+func (p *findPanel) update() {
+	p.lock.Lock()
+	defer func() {
+		p.lock.Unlock()
+		fe.qmlChanged(p, &p.Status)
+	}()
+
+	if !p.Visible {
+		return
+	}
+	bv := p.w.bw.ActiveView()
+	p.setTarget(bv)
+	p.re = nil
+	p.text = ""
+	p.matches = nil
+	p.locs = nil
+	p.Status = ""
+	if bv == nil || p.Pattern == "" {
+		if v := fe.view(bv); v != nil {
+			v.setMatches(nil)
+		}
+		return
+	}
+
+	re, err := compileSearch(p.Pattern, p.options())
+	if err != nil {
+		p.Status = err.Error()
+		if v := fe.view(bv); v != nil {
+			v.setMatches(nil)
+		}
+		return
+	}
+	p.re = re
+	p.text = bv.Substr(Region{0, bv.Size()})
+	p.matches, p.locs = findAll(re, p.text, 0)
+	if p.InSelection {
+		p.matches, p.locs = regionsWithin(p.matches, p.locs, p.scope)
+	}
+	if v := fe.view(bv); v != nil {
+		v.setMatches(p.matches)
+	}
+	p.Status = matchCount(len(p.matches))
+}
+
+func matchCount(n int) string {
+	switch n {
+	case 0:
+		return "No results"
+	case 1:
+		return "1 match"
+	}
+	return fmt.Sprintf("%d matches", n)
+}
+
+// search returns the matches of the pattern in bv. The caller must hold
+// p.lock.
+func (p *findPanel) search(bv *backend.View) ([]Region, error) {
+	if bv == p.bv && p.re != nil {
+		// the highlighted matches are up to date
+		return p.matches, nil
+	}
+	if bv == nil || p.Pattern == "" {
+		return nil, nil
+	}
+	re, err := compileSearch(p.Pattern, p.options())
+	if err != nil {
+		return nil, err
+	}
+	matches, locs := findAll(re, bv.Substr(Region{0, bv.Size()}), 0)
+	if p.InSelection {
+		matches, _ = regionsWithin(matches, locs, p.scope)
+	}
+	return matches, nil
+}
+
+// find selects the next match after the caret in bv, or the one before it
+// if forward isn't set
+func (p *findPanel) find(bv *backend.View, forward bool) {
+	p.lock.Lock()
+	defer func() {
+		p.lock.Unlock()
+		fe.qmlChanged(p, &p.Status)
+	}()
+
+	matches, err := p.search(bv)
+	if err != nil {
+		p.Status = err.Error()
+		return
+	}
+	if len(matches) == 0 {
+		return
+	}
+	pos := 0
+	if rs := bv.Sel().Regions(); len(rs) > 0 {
+		if forward {
+			pos = rs[len(rs)-1].End()
+		} else {
+			pos = rs[0].Begin()
+		}
+	}
+	i := nextMatch(matches, pos, forward, p.Wrap)
+	if i < 0 {
+		p.Status = "No more results"
+		return
+	}
+	p.Status = fmt.Sprintf("%d of %s", i+1, matchCount(len(matches)))
+	p.selectMatches(bv, matches[i:i+1])
+}
+
+// findAll selects all matches in bv
+func (p *findPanel) findAll(bv *backend.View) {
+	p.lock.Lock()
+	defer func() {
+		p.lock.Unlock()
+		fe.qmlChanged(p, &p.Status)
+	}()
+
+	matches, err := p.search(bv)
+	if err != nil {
+		p.Status = err.Error()
+		return
+	}
+	if len(matches) == 0 {
+		return
+	}
+	p.selectMatches(bv, matches)
+	fe.activate(bv)
+}
+
+func (p *findPanel) selectMatches(bv *backend.View, rs []Region) {
+	sel := bv.Sel()
+	sel.Clear()
+	sel.AddAll(rs)
+	fe.Show(bv, rs[0])
+	backend.OnSelectionModified.Call(bv)
+}
+
+// runCommand runs the find command name in the panel's window
+func (p *findPanel) runCommand(name string) {
+	go func() {
+		ch := backend.GetEditor().CommandHandler()
+		if err := ch.RunWindowCommand(p.w.bw, name, backend.Args{}); err != nil {
+			log.Error("Couldn't run %s: %s", name, err)
+		}
+	}()
+}
+
+// FindNext is called from QML to select the next match after the caret
+func (p *findPanel) FindNext() {
+	p.runCommand("find_panel_next")
+}
+
+// FindPrev is called from QML to select the match before the caret
+func (p *findPanel) FindPrev() {
+	p.runCommand("find_panel_prev")
+}
+
+// FindAll is called from QML to select all matches
+func (p *findPanel) FindAll() {
+	p.runCommand("find_panel_all")
+}
+
+// replacement returns what the i-th match should be replaced with. The
+// caller must hold p.lock.
+func (p *findPanel) replacement(i int) string {
+	if p.Regex {
+		return expandMatch(p.re, p.Replacement, p.text, p.locs[i])
+	}
+	return p.Replacement
+}
+
+// Replace is called from QML to replace the selected match, if the caret is
+// on one, and then find the next match
+func (p *findPanel) Replace() {
+	p.lock.Lock()
+	bv := p.bv
+	var (
+		match Region
+		found bool
+		text  string
+	)
+	if bv != nil {
+		if rs := bv.Sel().Regions(); len(rs) == 1 {
+			for i, m := range p.matches {
+				if m.Begin() == rs[0].Begin() && m.End() == rs[0].End() {
+					match, found = m, true
+					text = p.replacement(i)
+					break
+				}
+			}
+		}
+	}
+	p.lock.Unlock()
+
+	// the edit makes us search the view again, so it can't be done while
+	// holding the lock
+	if found {
+		e := bv.BeginEdit()
+		bv.Replace(e, match, text)
+		bv.EndEdit(e)
+	}
+	p.FindNext()
+}
+
+// ReplaceAll is called from QML to replace all matches in a single edit
+func (p *findPanel) ReplaceAll() {
+	p.lock.Lock()
+	bv := p.bv
+	matches := p.matches
+	texts := make([]string, len(matches))
+	for i := range matches {
+		texts[i] = p.replacement(i)
+	}
+	p.lock.Unlock()
+	if bv == nil || len(matches) == 0 {
+		return
+	}
+
+	e := bv.BeginEdit()
+	// going backwards keeps the regions of the remaining matches valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		bv.Replace(e, matches[i], texts[i])
+	}
+	bv.EndEdit(e)
+
+	p.lock.Lock()
+	p.Status = "Replaced " + matchCount(len(matches))
+	p.lock.Unlock()
+	fe.qmlChanged(p, &p.Status)
+}
+
+func (c *FindPanelNextCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil {
+		w.Find.find(bw.ActiveView(), true)
+	}
+	return nil
+}
+
+func (c *FindPanelPrevCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil {
+		w.Find.find(bw.ActiveView(), false)
+	}
+	return nil
+}
+
+func (c *FindPanelAllCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil {
+		w.Find.findAll(bw.ActiveView())
+	}
+	return nil
+}
@@ -5,9 +5,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"image/color"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +28,12 @@ const (
 	qmlWindowFile    = "qml/Window.qml"
 	qmlViewFile      = "qml/View.qml"
 
+	packagesPath       = "../packages"
+	defaultPackagePath = "../packages/Default"
+	userPackagePath    = "../packages/User"
+	// state that isn't configuration, like the session
+	localPath = "../local"
+
 	// http://qt-project.org/doc/qt-5.1/qtcore/qt.html#KeyboardModifier-enum
 	shift_mod  = 0x02000000
 	ctrl_mod   = 0x04000000
@@ -36,16 +42,46 @@ const (
 	keypad_mod = 0x20000000
 )
 
+// flags for frontend.show, these are mirrored in Buffer.qml
+const (
+	showSurrounds = 1 << iota // keep a few lines of context around the region
+	showAtCenter              // center the region vertically
+	keepToLeft                // don't scroll horizontally to the region
+	showAtTop                 // scroll the region to the top of the view
+)
+
 type (
 	// keeping track of frontend state
 	frontend struct {
-		lock        sync.Mutex
+		lock sync.Mutex
+		// guards windows, which is used from the goroutines of commands,
+		// dialogs and session saving
+		windowsLock sync.Mutex
 		windows     map[*backend.Window]*window
 		Console     *view
 		qmlDispatch chan qmlDispatch
 
-		promptWaitGroup sync.WaitGroup
-		promptResult    string
+		// modal dialogs waiting for their results
+		dialogs dialogs
+		// expires status messages and toasts
+		expirer expirer
+		// the recent toast notifications, guarded by lock
+		notifications []*notification
+		// the paths picked with the path panel
+		pathHistory *history
+		// the code entered in the console input
+		consoleHistory *history
+
+		// windows restored from the last session waiting for their qml
+		// counterpart, guarded by lock
+		restored map[*backend.Window]*windowSession
+
+		// instance requests waiting for views to be closed, guarded by lock
+		waiting map[*backend.View][]chan struct{}
+
+		// asks which unsaved views to save, unsavedDialog unless a test
+		// replaced it
+		askUnsaved func(bvs []*backend.View) (save []bool, ok bool)
 	}
 
 	// Used for batching qml.Changed calls
@@ -54,38 +90,118 @@ type (
 
 var fe *frontend
 
+// the show modes besides Show are asked for through backend.ShowFrontend
+var _ backend.ShowFrontend = (*frontend)(nil)
+
+// the groups of the layout are kept by the frontend, plugins ask for them
+// through the window methods of backend.GroupFrontend
+var _ backend.GroupFrontend = (*frontend)(nil)
+
+// OnVisibleRegionChanged is called when the part of a view's buffer shown on
+// screen changes, either by scrolling or resizing. Plugins get it through the
+// on_visible_region_changed method of their event listeners.
+var OnVisibleRegionChanged backend.ViewEvent
+
 func initFrontend() {
 	fe = &frontend{
-		windows: make(map[*backend.Window]*window),
+		windows:        make(map[*backend.Window]*window),
+		restored:       make(map[*backend.Window]*windowSession),
+		pathHistory:    newHistory(pathHistoryLen),
+		consoleHistory: newHistory(consoleHistoryLen),
+		waiting:        make(map[*backend.View][]chan struct{}),
 	}
 	go fe.qmlBatchLoop()
 	qml.Run(fe.loop)
 }
 
 func (f *frontend) window(w *backend.Window) *window {
+	f.windowsLock.Lock()
+	defer f.windowsLock.Unlock()
 	return f.windows[w]
 }
 
+// windowList returns the glue of all windows
+func (f *frontend) windowList() []*window {
+	f.windowsLock.Lock()
+	defer f.windowsLock.Unlock()
+	ret := make([]*window, 0, len(f.windows))
+	for _, w := range f.windows {
+		ret = append(ret, w)
+	}
+	return ret
+}
+
+// view returns the glue view of bv or nil if bv isn't known by the frontend
+func (f *frontend) view(bv *backend.View) *view {
+	if f.Console != nil && f.Console.bv == bv {
+		return f.Console
+	}
+	w := f.window(bv.Window())
+	if w == nil {
+		return nil
+	}
+	return w.view(bv)
+}
+
+// activate switches to the window, cell and tab holding bv
+func (f *frontend) activate(bv *backend.View) {
+	w := f.window(bv.Window())
+	if w == nil || w.qw == nil {
+		return
+	}
+	v := w.view(bv)
+	if v == nil {
+		return
+	}
+	if w.bw.ActiveView() != bv {
+		w.qw.Call("activateTab", v.id)
+	}
+	if backend.GetEditor().ActiveWindow() != w.bw {
+		w.raise()
+	}
+}
+
+// Show scrolls the view so that the region is visible keeping some
+// surrounding lines in sight
 func (f *frontend) Show(bv *backend.View, r Region) {
-	// TODO
+	f.show(bv, r, showSurrounds)
+}
+
+// ShowAtCenter scrolls the view so that the region is vertically centered.
+// The sublime module calls it for view.show_at_center.
+func (f *frontend) ShowAtCenter(bv *backend.View, r Region) {
+	f.show(bv, r, showAtCenter)
+}
+
+// ShowKeepToLeft scrolls the view so that the region is visible without
+// scrolling horizontally, keeping some surrounding lines in sight if
+// surrounds is set. The sublime module calls it for view.show with
+// keep_to_left.
+func (f *frontend) ShowKeepToLeft(bv *backend.View, r Region, surrounds bool) {
+	flags := keepToLeft
+	if surrounds {
+		flags |= showSurrounds
+	}
+	f.show(bv, r, flags)
+}
+
+func (f *frontend) show(bv *backend.View, r Region, flags int) {
+	v := f.view(bv)
+	if v == nil {
+		return
+	}
+	if v != f.Console {
+		f.activate(bv)
+	}
+	v.show(r, flags)
 }
 
 func (f *frontend) VisibleRegion(bv *backend.View) Region {
-	// TODO
-	return Region{0, bv.Size()}
-}
-
-func (f *frontend) StatusMessage(msg string) {
-	w := f.windows[backend.GetEditor().ActiveWindow()]
-	w.Status = msg
-	f.qmlChanged(w, &w.Status)
-	go func(msg string) {
-		time.Sleep(5 * time.Second)
-		if w.Status == msg {
-			w.Status = ""
-			f.qmlChanged(w, &w.Status)
-		}
-	}(msg)
+	v := f.view(bv)
+	if v == nil {
+		return Region{0, bv.Size()}
+	}
+	return v.visibleRegion()
 }
 
 const (
@@ -95,31 +211,47 @@ const (
 	criticalIcon
 	questionIcon
 
+	// the StandardButton values of qml
 	okButton     = 1024
+	yesButton    = 16384
+	noButton     = 65536
 	cancelButton = 4194304
 )
 
-func (f *frontend) message(text string, icon, btns int) string {
-	cbs := make(map[string]int)
-	if btns&okButton != 0 {
-		cbs["accepted"] = 1
-	}
-	if btns&cancelButton != 0 {
-		cbs["rejected"] = 0
-	}
+// the results of YesNoCancelDialog, with the values of sublime's
+// DIALOG_CANCEL, DIALOG_YES and DIALOG_NO
+const (
+	dialogCancel = iota
+	dialogYes
+	dialogNo
+)
 
-	w := f.windows[backend.GetEditor().ActiveWindow()]
-	obj := w.qw.ObjectByName("messageDialog")
-	obj.Set("text", text)
-	obj.Set("icon", icon)
-	obj.Set("standardButtons", btns)
+// dialogButton is a button with a custom caption, the result is passed to
+// PromptClosed when it's clicked
+type dialogButton struct {
+	result, caption string
+}
 
-	f.promptWaitGroup.Add(1)
-	obj.Call("open")
-	f.promptWaitGroup.Wait()
+func (f *frontend) message(text string, icon, btns int) string {
+	_, res := f.runDialog("messageDialog", func(obj qml.Object) {
+		obj.Set("text", text)
+		obj.Set("icon", icon)
+		obj.Set("standardButtons", btns)
+	})
+	return res
+}
 
-	log.Fine("returning %d from dialog", f.promptResult)
-	return f.promptResult
+// question asks text with the buttons given, it returns the result of the
+// button clicked or dialogRejected
+func (f *frontend) question(text string, btns ...dialogButton) string {
+	_, res := f.runDialog("questionDialog", func(obj qml.Object) {
+		obj.Set("text", text)
+		obj.Call("clear")
+		for _, b := range btns {
+			obj.Call("addButton", b.result, b.caption)
+		}
+	})
+	return res
 }
 
 func (f *frontend) ErrorMessage(msg string) {
@@ -131,42 +263,43 @@ func (f *frontend) MessageDialog(msg string) {
 	f.message(msg, informationIcon, okButton)
 }
 
+// OkCancelDialog asks msg and reports whether the ok button, captioned ok
+// unless it's empty, was clicked
 func (f *frontend) OkCancelDialog(msg, ok string) bool {
-	return f.message(msg, questionIcon, okButton|cancelButton) == "accepted"
-}
-
-func (f *frontend) Prompt(title, folder string, flags int) []string {
-	w := f.windows[backend.GetEditor().ActiveWindow()]
-	obj := w.qw.ObjectByName("fileDialog")
-	obj.Set("title", title)
-	obj.Set("folder", "file://"+folder)
-	obj.Set("selectExisting", flags&backend.PROMPT_SAVE_AS == 0)
-	obj.Set("selectFolder", flags&backend.PROMPT_ONLY_FOLDER == 1)
-	obj.Set("selectMultiple", flags&backend.PROMPT_SELECT_MULTIPLE == 1)
-
-	f.promptWaitGroup.Add(1)
-	obj.Call("open")
-	f.promptWaitGroup.Wait()
-
-	if f.promptResult != "accepted" {
-		return nil
+	if ok == "" {
+		return f.message(msg, questionIcon, okButton|cancelButton) == "accepted"
 	}
+	return f.question(msg, dialogButton{"accepted", ok}, dialogButton{"rejected", "Cancel"}) == "accepted"
+}
 
-	res := obj.List("fileUrls")
-	files := make([]string, res.Len())
-	res.Convert(&files)
-	for i, file := range files {
-		if file[:7] == "file://" {
-			files[i] = file[7:]
+// YesNoCancelDialog asks msg and returns dialogYes, dialogNo or dialogCancel.
+// The yes and no buttons are captioned yes and no unless they're empty.
+func (f *frontend) YesNoCancelDialog(msg, yes, no string) int {
+	var res string
+	if yes == "" && no == "" {
+		res = f.message(msg, questionIcon, yesButton|noButton|cancelButton)
+	} else {
+		if yes == "" {
+			yes = "Yes"
 		}
+		if no == "" {
+			no = "No"
+		}
+		res = f.question(msg, dialogButton{"yes", yes}, dialogButton{"no", no}, dialogButton{"rejected", "Cancel"})
 	}
-	log.Fine("Selected %s files", files)
-	return files
+	return yesNoCancelResult(res)
 }
 
-func (f *frontend) PromptClosed(result string) {
-	f.promptResult = result
-	f.promptWaitGroup.Done()
+// yesNoCancelResult maps the result of a dialog to what YesNoCancelDialog
+// returns
+func yesNoCancelResult(res string) int {
+	switch res {
+	case "yes":
+		return dialogYes
+	case "no":
+		return dialogNo
+	}
+	return dialogCancel
 }
 
 func (f *frontend) scroll(b Buffer) {
@@ -229,48 +362,67 @@ func (f *frontend) DefaultFg() color.RGBA {
 
 // Called when a new view is opened
 func (f *frontend) onNew(bv *backend.View) {
-	w := f.windows[bv.Window()]
+	w := f.window(bv.Window())
 	v := newView(bv)
-	w.views[bv] = v
+	w.setView(bv, v)
+	// restored views go back to their group, others to the active one
+	group := -1
+	if ws := f.restoredSession(bv.Window()); ws != nil {
+		if vs := ws.views[bv]; vs != nil {
+			group = vs.Group
+		}
+	}
+	group = w.addView(bv, group)
 	if w.qw != nil {
-		w.qw.Call("addTab", v.id, v)
+		w.qw.Call("addTab", v.id, v, group)
 		w.qw.Call("activateTab", v.id)
 	}
+	f.updateTitles()
 }
 
 // called when a view is closed
 func (f *frontend) onClose(bv *backend.View) {
-	w := f.windows[bv.Window()]
-	v := w.views[bv]
+	w := f.window(bv.Window())
+	v := w.forgetView(bv)
 	if v == nil {
 		log.Error("Couldn't find closed view...")
 		return
 	}
 	w.qw.Call("removeTab", v.id)
-	delete(w.views, bv)
+	w.removeView(bv)
+	w.FindInFiles.forget(bv)
+	f.doneWaiting(bv)
+	f.updateTitles()
 }
 
 // called when a view has loaded
 func (f *frontend) onLoad(bv *backend.View) {
-	w := f.windows[bv.Window()]
-	v := w.views[bv]
+	w := f.window(bv.Window())
+	v := w.view(bv)
 	if v == nil {
 		log.Error("Couldn't find loaded view")
 		return
 	}
-	v.Title = bv.FileName()
-	w.qw.Call("setTabTitle", v.id, v.Title)
+	f.updateTitles()
+}
+
+// called when a view was saved, possibly under another name
+func (f *frontend) onPostSave(bv *backend.View) {
+	f.updateTitles()
+	// saving may change the line endings and encoding
+	if v := f.view(bv); v != nil {
+		v.updateSegments()
+	}
 }
 
 func (f *frontend) onSelectionModified(bv *backend.View) {
-	w := f.windows[bv.Window()]
-	v := w.views[bv]
+	w := f.window(bv.Window())
+	v := w.view(bv)
 	if v == nil {
 		log.Error("Couldn't find modified view")
 		return
 	}
-	v.updateSelectionStatus()
-	f.qmlChanged(v, &v.SelectionStatus)
+	v.updateSegments()
 	if v.qv == nil {
 		return
 	}
@@ -278,14 +430,35 @@ func (f *frontend) onSelectionModified(bv *backend.View) {
 }
 
 func (f *frontend) onStatusChanged(bv *backend.View) {
-	w := f.windows[bv.Window()]
-	v := w.views[bv]
+	w := f.window(bv.Window())
+	v := w.view(bv)
 	if v == nil {
 		log.Error("Couldn't find status changed view")
 		return
 	}
 	v.updateStatus()
-	f.qmlChanged(v, &v.Status)
+}
+
+// keeps the dirty marker and the matches highlighted by the find panel up
+// to date
+func (f *frontend) onModified(bv *backend.View) {
+	f.updateTitle(bv)
+	if w := f.window(bv.Window()); w != nil && w.Find.Visible && w.Find.bv == bv {
+		w.Find.update()
+	}
+}
+
+// keeps track of the active group and moves the matches highlighted by the
+// find panel to the activated view
+func (f *frontend) onActivated(bv *backend.View) {
+	w := f.window(bv.Window())
+	if w == nil {
+		return
+	}
+	w.activated(bv)
+	if w.Find.Visible {
+		w.Find.update()
+	}
 }
 
 // Launches the provided command in a new goroutine
@@ -301,39 +474,65 @@ func (f *frontend) RunCommandWithArgs(command string, args backend.Args) {
 
 func (f *frontend) HandleInput(text string, keycode int, modifiers int) bool {
 	log.Debug("frontend.HandleInput: text=%v, key=%x, modifiers=%x", text, keycode, modifiers)
-	shift := false
-	alt := false
-	ctrl := false
-	super := false
+	if isDeadKey(keycode) {
+		// the composed character comes with the next key press
+		return true
+	}
+	mods := modifierMapSetting(backend.GetEditor().Settings())
+	kp, ok := keyPress(text, keycode, modifiers, mods)
+	if !ok {
+		return false
+	}
+	if f.readOnlyInput(kp) {
+		return true
+	}
+	ed := backend.GetEditor()
+	kp = typeKeypadKey(kp, func(kp keys.KeyPress) bool {
+		bound := ed.KeyBindings().Filter(kp)
+		return bound.Len() > 0
+	})
+	ed.HandleInput(kp)
+	return true
+}
 
-	if key, ok := lut[keycode]; ok {
-		ed := backend.GetEditor()
+// InsertText is called from QML with the text an input method committed,
+// which is inserted into the active view as a single edit
+func (f *frontend) InsertText(text string) {
+	log.Debug("frontend.InsertText: text=%v", text)
+	bw := backend.GetEditor().ActiveWindow()
+	if bw == nil {
+		return
+	}
+	if bv := bw.ActiveView(); bv == nil || bv.Settings().Bool("read_only", false) {
+		return
+	}
+	f.RunCommandWithArgs("insert", backend.Args{"characters": text})
+}
 
-		if modifiers&shift_mod != 0 {
-			shift = true
-		}
-		if modifiers&alt_mod != 0 {
-			alt = true
-		}
-		if modifiers&ctrl_mod != 0 {
-			if runtime.GOOS == "darwin" {
-				super = true
-			} else {
-				ctrl = true
-			}
-		}
-		if modifiers&meta_mod != 0 {
-			if runtime.GOOS == "darwin" {
-				ctrl = true
-			} else {
-				super = true
+// readOnlyInput swallows key presses that would edit a read only view, like
+// the find results. Enter opens the result on the caret's line instead.
+func (f *frontend) readOnlyInput(kp keys.KeyPress) bool {
+	bw := backend.GetEditor().ActiveWindow()
+	if bw == nil {
+		return false
+	}
+	bv := bw.ActiveView()
+	if bv == nil || !bv.Settings().Bool("read_only", false) {
+		return false
+	}
+	switch kp.Key {
+	case keys.Enter, keys.KeypadEnter:
+		if rs := bv.Sel().Regions(); len(rs) > 0 {
+			row, _ := bv.RowCol(rs[0].B)
+			if w := f.window(bw); w != nil {
+				w.FindInFiles.open(bv, row)
 			}
 		}
-
-		ed.HandleInput(keys.KeyPress{Text: text, Key: key, Shift: shift, Alt: alt, Ctrl: ctrl, Super: super})
+		return true
+	case keys.Backspace, keys.Delete, '\t':
 		return true
 	}
-	return false
+	return kp.Text != "" && !kp.Ctrl && !kp.Super
 }
 
 func (f *frontend) colorScheme() backend.ColorScheme {
@@ -341,17 +540,133 @@ func (f *frontend) colorScheme() backend.ColorScheme {
 	return ed.GetColorScheme(ed.Settings().String("color_scheme", ""))
 }
 
-// Quit closes all open windows to de-reference all qml objects
+// Quit saves the session and closes all windows. Unless hot_exit is enabled
+// the user is asked what to do with unsaved buffers first.
 func (f *frontend) Quit() (err error) {
-	// TODO: handle changed files that aren't saved.
-	for _, w := range f.windows {
+	go func() {
+		if !f.confirmQuit(backend.GetEditor().Windows()) {
+			return
+		}
+		if err := f.saveSession(); err != nil {
+			log.Error("Couldn't save session: %s", err)
+		}
+		f.closeAll()
+	}()
+	return
+}
+
+// hotExit reports whether unsaved changes are kept in the session when
+// quitting instead of asking about them
+func hotExit() bool {
+	return backend.GetEditor().Settings().Bool("hot_exit", false)
+}
+
+// confirmQuit is asked before quitting, which closing the last window is
+// too. With hot_exit unsaved changes are kept in the session, otherwise the
+// user is asked about those in bws like when closing a window.
+func (f *frontend) confirmQuit(bws []*backend.Window) bool {
+	return hotExit() || f.confirmClose(bws)
+}
+
+// confirmClose lists the unsaved views of the given windows in a single
+// dialog and saves the ones the user chose. Views the user chose to discard
+// are marked as scratch so the backend won't ask about them again. Returns
+// false if the user cancelled.
+func (f *frontend) confirmClose(bws []*backend.Window) bool {
+	var dirty []*backend.View
+	for _, bw := range bws {
+		for _, bv := range bw.Views() {
+			if bv.IsDirty() {
+				dirty = append(dirty, bv)
+			}
+		}
+	}
+	if len(dirty) == 0 {
+		return true
+	}
+
+	ask := f.askUnsaved
+	if ask == nil {
+		ask = f.unsavedDialog
+	}
+	save, ok := ask(dirty)
+	if !ok {
+		return false
+	}
+	for i, bv := range dirty {
+		if !save[i] {
+			bv.SetScratch(true)
+			continue
+		}
+		if err := f.save(bv); err == errSaveCancelled {
+			return false
+		} else if err != nil {
+			f.ErrorMessage(fmt.Sprintf("Couldn't save %s: %s", viewName(bv), err))
+			return false
+		}
+	}
+	return true
+}
+
+// unsavedDialog asks which of the given views should be saved. ok is false
+// if the user cancelled.
+func (f *frontend) unsavedDialog(bvs []*backend.View) (save []bool, ok bool) {
+	obj, res := f.runDialog("unsavedDialog", func(obj qml.Object) {
+		obj.Call("clear")
+		for _, bv := range bvs {
+			obj.Call("addFile", viewName(bv))
+		}
+	})
+
+	save = make([]bool, len(bvs))
+	switch res {
+	case "accepted":
+		for i := range bvs {
+			save[i], _ = obj.Call("isChecked", i).(bool)
+		}
+	case "discard":
+	default:
+		return nil, false
+	}
+	return save, true
+}
+
+var errSaveCancelled = errors.New("save cancelled")
+
+// save saves bv, asking for a file name if it doesn't have one yet
+func (f *frontend) save(bv *backend.View) error {
+	if bv.FileName() != "" {
+		return bv.Save()
+	}
+	opts := promptOptions{title: "Save file", flags: backend.PROMPT_SAVE_AS}
+	opts.suggest(bv)
+	files := f.promptFiles(opts)
+	if len(files) == 0 {
+		return errSaveCancelled
+	}
+	return bv.SaveAs(files[0])
+}
+
+// viewName returns a name for bv suitable to show to the user
+func viewName(bv *backend.View) string {
+	if name := bv.FileName(); name != "" {
+		return name
+	}
+	if name := bv.Name(); name != "" {
+		return name
+	}
+	return "untitled"
+}
+
+// closeAll closes all open windows to de-reference all qml objects
+func (f *frontend) closeAll() {
+	for _, w := range f.windowList() {
 		if w.qw != nil {
 			w.qw.Hide()
 			w.qw.Destroy()
 			w.qw = nil
 		}
 	}
-	return
 }
 
 func (f *frontend) loop() (err error) {
@@ -360,15 +675,21 @@ func (f *frontend) loop() (err error) {
 	// after the UI is up and running. but because we dont have any
 	// scheme we are initing editor before the UI comes up.
 	ed.Init()
-	ed.SetDefaultPath("../packages/Default")
-	ed.SetUserPath("../packages/User")
+	if err := initLimeModule(); err != nil {
+		log.Error("Couldn't add the lime python module: %s", err)
+	}
+	ed.SetDefaultPath(defaultPackagePath)
+	ed.SetUserPath(userPackagePath)
 
 	// Some packages(e.g Vintageos) need available window and view at start
 	// so we need at least one window and view before loading packages.
 	// Sublime text also has available window view on startup
-	w := ed.NewWindow()
-	w.NewFile()
-	ed.AddPackagesPath("../packages")
+	if !f.restoreSession() {
+		w := ed.NewWindow()
+		w.NewFile()
+	}
+	ed.AddPackagesPath(packagesPath)
+	loadFindKeymap()
 
 	ed.SetFrontend(f)
 	ed.LogInput(false)
@@ -420,8 +741,14 @@ func (f *frontend) loop() (err error) {
 
 	addWindow := func(bw *backend.Window) {
 		w := newWindow(bw)
+		f.windowsLock.Lock()
 		f.windows[bw] = w
+		f.windowsLock.Unlock()
+		if ws := f.restoredSession(bw); ws != nil {
+			w.geometry = ws.Geometry
+		}
 		w.launch(&wg, component)
+		f.applySession(w)
 	}
 
 	backend.OnNew.Add(f.onNew)
@@ -430,6 +757,9 @@ func (f *frontend) loop() (err error) {
 	backend.OnSelectionModified.Add(f.onSelectionModified)
 	backend.OnNewWindow.Add(addWindow)
 	backend.OnStatusChanged.Add(f.onStatusChanged)
+	backend.OnModified.Add(f.onModified)
+	backend.OnPostSave.Add(f.onPostSave)
+	backend.OnActivated.Add(f.onActivated)
 
 	// we need to add windows and views that are added before we registered
 	// actions for OnNewWindow and OnNew events
@@ -439,6 +769,19 @@ func (f *frontend) loop() (err error) {
 			f.onNew(v)
 			f.onLoad(v)
 		}
+		f.applyViewSessions(f.window(w))
+	}
+	go f.autoSaveSession()
+
+	if launch != nil {
+		f.applyLaunchArgs(launch)
+	}
+	if path, err := instanceSocketPath(); err != nil {
+		log.Error("Couldn't listen for other instances: %s", err)
+	} else if srv, err := listenInstance(path, f.handleInstanceRequest); err != nil {
+		log.Error("Couldn't listen for other instances: %s", err)
+	} else {
+		defer srv.Close()
 	}
 
 	defer func() {
@@ -461,7 +804,7 @@ func (f *frontend) loop() (err error) {
 
 	go func() {
 		// reloadRequested = true
-		// f.Quit()
+		// f.closeAll()
 
 		lastTime := time.Now()
 
@@ -476,7 +819,7 @@ func (f *frontend) loop() (err error) {
 				}
 				if strings.HasSuffix(ev.Name, ".qml") && ev.Op == fsnotify.Write && ev.Op != fsnotify.Chmod && !reloadRequested && waiting {
 					reloadRequested = true
-					f.Quit()
+					f.closeAll()
 					lastTime = time.Now()
 				}
 			}
@@ -495,7 +838,7 @@ func (f *frontend) loop() (err error) {
 		waiting = false
 		log.Debug("All windows closed. reloadRequest: %v", reloadRequested)
 		// then we check if there's a reload request in the pipe
-		if !reloadRequested || len(f.windows) == 0 {
+		if !reloadRequested || len(f.windowList()) == 0 {
 			// This would be a genuine exit; all windows closed by the user
 			break
 		}
@@ -524,8 +867,12 @@ func (f *frontend) loop() (err error) {
 		}
 		log.Debug("re-launching all windows")
 		// Succeeded loading the file, re-launch all windows
-		for _, w := range f.windows {
+		for _, w := range f.windowList() {
 			w.launch(&wg, component)
+			w.groupsLock.Lock()
+			l := w.layout
+			w.groupsLock.Unlock()
+			w.qw.Call("setLayout", l.json())
 
 			for _, bv := range w.Back().Views() {
 				f.onNew(bv)
@@ -0,0 +1,59 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/limetext/backend"
+)
+
+func TestQuitAsksAboutUnsavedViews(t *testing.T) {
+	ed := backend.GetEditor()
+	bw := ed.NewWindow()
+	defer bw.Close()
+	bv := bw.NewFile()
+	defer func() {
+		bv.SetScratch(true)
+		bv.Close()
+	}()
+	e := bv.BeginEdit()
+	bv.Insert(e, 0, "unsaved")
+	bv.EndEdit(e)
+
+	asked := make(chan []*backend.View, 1)
+	f := &frontend{askUnsaved: func(bvs []*backend.View) ([]bool, bool) {
+		asked <- bvs
+		return nil, false
+	}}
+
+	ed.Settings().Set("hot_exit", false)
+	defer ed.Settings().Erase("hot_exit")
+	f.Quit()
+	select {
+	case bvs := <-asked:
+		found := false
+		for _, v := range bvs {
+			found = found || v == bv
+		}
+		if !found {
+			t.Errorf("Expected to be asked about the unsaved view, got %v", bvs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected to be asked about the unsaved view before quitting")
+	}
+
+	// with hot_exit the changes are kept in the session instead
+	ed.Settings().Set("hot_exit", true)
+	if !f.confirmQuit([]*backend.Window{bw}) {
+		t.Error("Expected quitting to go ahead with hot_exit")
+	}
+	select {
+	case <-asked:
+		t.Error("Expected not to be asked with hot_exit")
+	default:
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// fuzzyMatch reports whether all the runes of pattern appear in s in the
+// same order, ignoring case. Matches at word starts and runs of consecutive
+// runes score higher, long strings score lower. matched holds the rune
+// indices of s that matched.
+func fuzzyMatch(pattern, s string) (score int, matched []int, ok bool) {
+	p := []rune(strings.ToLower(pattern))
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+	r := []rune(s)
+	matched = make([]int, 0, len(p))
+
+	pi, prev := 0, -2
+	for i := 0; i < len(r) && pi < len(p); i++ {
+		if unicode.ToLower(r[i]) != p[pi] {
+			continue
+		}
+		score++
+		if i == prev+1 {
+			score += 5
+		}
+		if isWordStart(r, i) {
+			score += 8
+		}
+		matched = append(matched, i)
+		prev = i
+		pi++
+	}
+	if pi < len(p) {
+		return 0, nil, false
+	}
+	score -= matched[0] + (len(r)-len(p))/4
+	return score, matched, true
+}
+
+func isWordStart(r []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	c, prev := r[i], r[i-1]
+	if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+		return true
+	}
+	return unicode.IsUpper(c) && unicode.IsLower(prev)
+}
+
+// fuzzyMarkup returns s as qml styled text with the matched runes in bold
+func fuzzyMarkup(s string, matched []int) string {
+	var buf []string
+	mi := 0
+	for i, c := range []rune(s) {
+		t := html.EscapeString(string(c))
+		if mi < len(matched) && matched[mi] == i {
+			t = "<b>" + t + "</b>"
+			mi++
+		}
+		buf = append(buf, t)
+	}
+	return strings.Join(buf, "")
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		matched    []int
+		ok         bool
+	}{
+		{"", "anything", nil, true},
+		{"ts", "Toggle Side Bar", []int{0, 7}, true},
+		{"TSB", "toggle side bar", []int{0, 7, 12}, true},
+		{"gl", "goto_line", []int{0, 5}, true},
+		{"go", "Goto", []int{0, 1}, true},
+		{"ödé", "ünïcödé", []int{4, 5, 6}, true},
+		{"ba", "ab", nil, false},
+		{"abc", "ab", nil, false},
+		{"x", "", nil, false},
+	}
+	for i, test := range tests {
+		_, matched, ok := fuzzyMatch(test.pattern, test.s)
+		if ok != test.ok || !reflect.DeepEqual(matched, test.matched) {
+			t.Errorf("Test %d: Expected %v, %v, but got %v, %v", i, test.matched, test.ok, matched, ok)
+		}
+	}
+}
+
+func TestFuzzyMatchRanking(t *testing.T) {
+	tests := []struct {
+		pattern       string
+		better, worse string
+	}{
+		// word starts
+		{"ts", "Toggle Side Bar", "Tabs"},
+		{"fb", "FooBar", "Foobar"},
+		// consecutive runes
+		{"save", "Save All", "Set Syntax: Ave"},
+		// earlier matches
+		{"view", "View: Toggle", "Toggle View"},
+		// shorter strings
+		{"copy", "Copy", "Copy File Path"},
+	}
+	for i, test := range tests {
+		better, _, ok1 := fuzzyMatch(test.pattern, test.better)
+		worse, _, ok2 := fuzzyMatch(test.pattern, test.worse)
+		if !ok1 || !ok2 || better <= worse {
+			t.Errorf("Test %d: Expected %q to score higher than %q for %q, got %d and %d", i, test.better, test.worse, test.pattern, better, worse)
+		}
+	}
+}
+
+func TestFuzzyMarkup(t *testing.T) {
+	tests := []struct {
+		s       string
+		matched []int
+		exp     string
+	}{
+		{"abc", nil, "abc"},
+		{"abc", []int{0, 2}, "<b>a</b>b<b>c</b>"},
+		{"a<b", []int{1}, "a<b>&lt;</b>b"},
+		{"ünï", []int{1}, "ü<b>n</b>ï"},
+	}
+	for i, test := range tests {
+		if m := fuzzyMarkup(test.s, test.matched); m != test.exp {
+			t.Errorf("Test %d: Expected %q, but got %q", i, test.exp, m)
+		}
+	}
+}
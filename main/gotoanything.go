@@ -0,0 +1,406 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+	. "github.com/limetext/text"
+)
+
+var (
+	defaultFileExcludePatterns = []string{
+		"*.pyc", "*.pyo", "*.exe", "*.dll", "*.obj", "*.o", "*.a", "*.lib",
+		"*.so", "*.dylib", "*.ncb", "*.sdf", "*.suo", "*.pdb", "*.idb",
+		".DS_Store", "*.class", "*.psd", "*.db", "*.sublime-workspace",
+	}
+	defaultFolderExcludePatterns = []string{".svn", ".git", ".hg", "CVS"}
+)
+
+// how many files to index between refreshing the overlay
+const indexRefreshInterval = 1000
+
+type (
+	// fileIndex is the list of files under a window's project folders, it
+	// is filled in the background and updated on every goto anything
+	fileIndex struct {
+		lock     sync.Mutex
+		files    []*overlayItem
+		building bool
+		// the folders and exclude patterns it was built for
+		key string
+	}
+
+	// gotoAnything is the overlay source of the goto anything overlay. The
+	// query is a file name optionally followed by :line, @symbol or #term,
+	// without a file name those apply to the current view.
+	gotoAnything struct {
+		w     *window
+		index *fileIndex
+
+		// the view active when the overlay was opened and its first row
+		orig    *backend.View
+		origRow int
+		// the view we opened to preview the highlighted file, it is closed
+		// again unless the file is picked
+		preview *backend.View
+		query   gotoQuery
+	}
+
+	gotoQuery struct {
+		file string
+		kind byte // one of ':', '@', '#' or 0
+		arg  string
+	}
+)
+
+func newGotoAnything(w *window) *gotoAnything {
+	g := &gotoAnything{
+		w:     w,
+		index: w.fileIndex(),
+		orig:  w.bw.ActiveView(),
+	}
+	if v := w.view(g.orig); v != nil {
+		v.visibleLock.Lock()
+		g.origRow = v.firstRow
+		v.visibleLock.Unlock()
+	}
+	return g
+}
+
+// fileIndex returns the index of the files of the window's project, which is
+// updated in the background. A new one is built once the folders or exclude
+// patterns changed.
+func (w *window) fileIndex() *fileIndex {
+	settings := w.bw.Settings()
+	folders := w.bw.Project().Folders()
+	fileEx := stringsSetting(settings, "file_exclude_patterns", defaultFileExcludePatterns)
+	folderEx := stringsSetting(settings, "folder_exclude_patterns", defaultFolderExcludePatterns)
+	key := fmt.Sprint(folders, fileEx, folderEx)
+
+	w.indexLock.Lock()
+	defer w.indexLock.Unlock()
+	if w.index == nil || w.index.key != key {
+		w.index = &fileIndex{key: key}
+	}
+	w.index.update(folders, fileEx, folderEx, w.refreshGotoAnything)
+	return w.index
+}
+
+// stringsSetting returns the string list setting name or def if it isn't set
+func stringsSetting(s *Settings, name string, def []string) []string {
+	list, ok := s.Get(name, nil).([]interface{})
+	if !ok {
+		return def
+	}
+	ret := make([]string, 0, len(list))
+	for _, it := range list {
+		if str, ok := it.(string); ok {
+			ret = append(ret, str)
+		}
+	}
+	return ret
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// update walks the folders again in the background unless that's already
+// happening, so that files created or removed since are picked up
+func (idx *fileIndex) update(folders, fileEx, folderEx []string, refresh func()) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if idx.building {
+		return
+	}
+	idx.building = true
+	go idx.build(folders, fileEx, folderEx, idx.files == nil, refresh)
+}
+
+// build walks the folders collecting all files not excluded by the
+// patterns, which replace the indexed ones once it's done. The first build
+// of an index adds them as they are found instead, calling refresh every now
+// and then. refresh is called once it's done too.
+func (idx *fileIndex) build(folders, fileEx, folderEx []string, first bool, refresh func()) {
+	var files []*overlayItem
+	n := 0
+	for _, folder := range folders {
+		prefix := ""
+		if len(folders) > 1 {
+			prefix = filepath.Base(folder)
+		}
+		filepath.Walk(folder, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				log.Fine("Skipping %s while indexing: %s", path, err)
+				return nil
+			}
+			if fi.IsDir() {
+				if path != folder && matchesAny(fi.Name(), folderEx) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if matchesAny(fi.Name(), fileEx) {
+				return nil
+			}
+
+			rel, _ := filepath.Rel(folder, path)
+			files = append(files, &overlayItem{
+				Caption: filepath.Join(prefix, rel),
+				Detail:  path,
+				Enabled: true,
+				value:   path,
+			})
+
+			if n++; first && n%indexRefreshInterval == 0 {
+				idx.lock.Lock()
+				idx.files = files
+				idx.lock.Unlock()
+				refresh()
+			}
+			return nil
+		})
+	}
+	idx.lock.Lock()
+	idx.files = files
+	idx.building = false
+	idx.lock.Unlock()
+	refresh()
+}
+
+func (idx *fileIndex) snapshot() []*overlayItem {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	return idx.files[:len(idx.files):len(idx.files)]
+}
+
+// refreshGotoAnything filters goto anything again with the files indexed so
+// far, if it's shown
+func (w *window) refreshGotoAnything() {
+	if o := w.Overlay; o != nil {
+		if _, ok := o.currentSource().(*gotoAnything); ok {
+			o.refresh()
+		}
+	}
+}
+
+func parseGotoQuery(q string) gotoQuery {
+	i := strings.IndexAny(q, ":@#")
+	if i < 0 {
+		return gotoQuery{file: q}
+	}
+	return gotoQuery{file: q[:i], kind: q[i], arg: q[i+1:]}
+}
+
+func (g *gotoAnything) items() []*overlayItem {
+	return nil
+}
+
+func (g *gotoAnything) filter(query string) []*overlayItem {
+	g.query = parseGotoQuery(query)
+	if g.query.file != "" || g.query.kind == 0 {
+		files := g.index.snapshot()
+		// don't mess with the index's items, the snapshot shares them
+		items := make([]*overlayItem, len(files))
+		for i, it := range files {
+			cp := *it
+			items[i] = &cp
+		}
+		return fuzzyFilter(items, g.query.file, func(it *overlayItem) string { return it.Caption })
+	}
+
+	// no file, the query applies to the current view
+	bv := g.orig
+	if bv == nil {
+		return nil
+	}
+	switch g.query.kind {
+	case '@':
+		return symbolItems(bv, g.query.arg)
+	case ':':
+		return []*overlayItem{{
+			Caption: "Go to line " + g.query.arg,
+			Markup:  "Go to line " + g.query.arg,
+			Enabled: true,
+		}}
+	default:
+		return []*overlayItem{{
+			Caption: "Find " + g.query.arg,
+			Markup:  "Find " + g.query.arg,
+			Enabled: true,
+		}}
+	}
+}
+
+// symbolItems returns the symbols of bv fuzzy matching query
+func symbolItems(bv *backend.View, query string) []*overlayItem {
+	var items []*overlayItem
+	for _, r := range viewSymbols(bv) {
+		row, _ := bv.RowCol(r.Begin())
+		items = append(items, &overlayItem{
+			Caption: bv.Substr(r),
+			Detail:  fmt.Sprintf("line %d", row+1),
+			Enabled: true,
+			value:   r,
+		})
+	}
+	return fuzzyFilter(items, query, func(it *overlayItem) string { return it.Caption })
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// viewSymbols returns the regions of the words in bv that are scoped as
+// names of definitions, like functions and types
+func viewSymbols(bv *backend.View) []Region {
+	rs := bv.SubstrR(Region{0, bv.Size()})
+	var syms []Region
+	for i := 0; i < len(rs); {
+		if !isWordRune(rs[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(rs) && isWordRune(rs[j]) {
+			j++
+		}
+		if strings.Contains(bv.ScopeName(i), "entity.name") {
+			syms = append(syms, Region{i, j})
+		}
+		i = j
+	}
+	return syms
+}
+
+// findTerm returns the first case insensitive occurrence of term in bv, or
+// an empty region at -1 if there is none
+func findTerm(bv *backend.View, term string) Region {
+	t := []rune(strings.ToLower(term))
+	rs := []rune(strings.ToLower(bv.Substr(Region{0, bv.Size()})))
+	if len(t) == 0 {
+		return Region{-1, -1}
+	}
+outer:
+	for i := 0; i+len(t) <= len(rs); i++ {
+		for j := range t {
+			if rs[i+j] != t[j] {
+				continue outer
+			}
+		}
+		return Region{i, i + len(t)}
+	}
+	return Region{-1, -1}
+}
+
+// target returns the region the query's suffix refers to in bv
+func (g *gotoAnything) target(bv *backend.View, item *overlayItem) (Region, bool) {
+	switch g.query.kind {
+	case ':':
+		parts := strings.SplitN(g.query.arg, ":", 2)
+		line, err := strconv.Atoi(parts[0])
+		if err != nil || line < 1 {
+			return Region{}, false
+		}
+		col := 0
+		if len(parts) == 2 {
+			if c, err := strconv.Atoi(parts[1]); err == nil && c > 0 {
+				col = c - 1
+			}
+		}
+		p := bv.TextPoint(line-1, col)
+		return Region{p, p}, true
+	case '@':
+		if r, ok := item.value.(Region); ok {
+			return r, true
+		}
+		if syms := symbolItems(bv, g.query.arg); len(syms) > 0 {
+			return syms[0].value.(Region), true
+		}
+	case '#':
+		if r := findTerm(bv, g.query.arg); r.A >= 0 {
+			return r, true
+		}
+	}
+	return Region{}, false
+}
+
+// open shows the item, opening its file as a preview if needed. Returns the
+// view the item is in.
+func (g *gotoAnything) open(item *overlayItem) *backend.View {
+	path, ok := item.value.(string)
+	if !ok {
+		return g.orig
+	}
+	for _, bv := range g.w.bw.Views() {
+		if bv.FileName() == path {
+			if bv != g.preview {
+				g.closePreview()
+			}
+			fe.activate(bv)
+			return bv
+		}
+	}
+	g.closePreview()
+	g.preview = g.w.bw.OpenFile(path, 0)
+	return g.preview
+}
+
+func (g *gotoAnything) closePreview() {
+	if g.preview != nil && !g.preview.IsDirty() {
+		g.preview.Close()
+	}
+	g.preview = nil
+}
+
+func (g *gotoAnything) highlighted(item *overlayItem) {
+	bv := g.open(item)
+	if bv == nil {
+		return
+	}
+	if r, ok := g.target(bv, item); ok {
+		fe.ShowAtCenter(bv, r)
+	}
+}
+
+func (g *gotoAnything) selected(item *overlayItem) {
+	bv := g.open(item)
+	// keep the previewed file open
+	g.preview = nil
+	if bv == nil {
+		return
+	}
+	if r, ok := g.target(bv, item); ok {
+		bv.Sel().Clear()
+		bv.Sel().Add(r)
+		fe.ShowAtCenter(bv, r)
+	}
+}
+
+func (g *gotoAnything) cancelled() {
+	g.closePreview()
+	if g.orig == nil {
+		return
+	}
+	fe.activate(g.orig)
+	if v := g.w.view(g.orig); v != nil {
+		p := g.orig.TextPoint(g.origRow, 0)
+		v.show(Region{p, p}, showAtTop|keepToLeft)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import "sync"
+
+// history is a list of recent entries, most recent first and without
+// duplicates. It's saved with the session.
+type history struct {
+	lock    sync.Mutex
+	entries []string
+	max     int
+}
+
+func newHistory(max int) *history {
+	return &history{max: max}
+}
+
+// add moves entry to the front of the history
+func (h *history) add(entry string) {
+	if entry == "" {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	entries := []string{entry}
+	for _, e := range h.entries {
+		if e != entry && len(entries) < h.max {
+			entries = append(entries, e)
+		}
+	}
+	h.entries = entries
+}
+
+// list returns a copy of the entries
+func (h *history) list() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]string(nil), h.entries...)
+}
+
+// set replaces the entries, used when restoring the session
+func (h *history) set(entries []string) {
+	h.lock.Lock()
+	h.entries = nil
+	h.lock.Unlock()
+	for i := len(entries) - 1; i >= 0; i-- {
+		h.add(entries[i])
+	}
+}
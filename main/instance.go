@@ -0,0 +1,262 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+	"github.com/limetext/qml-go"
+)
+
+// Version of the protocol spoken over the instance socket. Bump it whenever
+// instanceRequest or instanceResponse change in an incompatible way.
+const instanceProtocolVersion = 1
+
+const (
+	instanceOK   = "ok"
+	instanceDone = "done"
+	instanceErr  = "error"
+)
+
+type (
+	// instanceRequest is sent by a new invocation to the running instance.
+	// Both are json encoded, one per line.
+	instanceRequest struct {
+		Version int         `json:"version"`
+		Args    *launchArgs `json:"args"`
+		// Wait asks the instance to send instanceDone once all views opened
+		// for this request are closed
+		Wait bool `json:"wait,omitempty"`
+	}
+
+	instanceResponse struct {
+		Version int    `json:"version"`
+		Status  string `json:"status"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	// instanceHandler handles a request, the returned channel is closed
+	// once the request is done, which is only waited for if the request
+	// asked for it.
+	instanceHandler func(req *instanceRequest) (done <-chan struct{}, err error)
+
+	// instanceServer listens for requests of other invocations
+	instanceServer struct {
+		path   string
+		ln     net.Listener
+		handle instanceHandler
+	}
+)
+
+var errInstanceVersion = errors.New("instance protocol version mismatch")
+
+// instanceSocketPath returns the per user socket path of the instance.
+// Without XDG_RUNTIME_DIR it's in a directory of the temp dir that only we
+// may access, so no other user can listen in our place.
+func instanceSocketPath() (string, error) {
+	name := fmt.Sprintf("lime-%d.sock", os.Getuid())
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, name), nil
+	}
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("lime-%d", os.Getuid()))
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	// someone else may have created it first
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != 0700 {
+		return "", fmt.Errorf("%s isn't a directory only we may access", dir)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// sendToInstance sends req to the instance listening on path. If req.Wait is
+// set it blocks until the instance reports the request as done. Returns an
+// error satisfying isNoInstance if there is no instance to talk to.
+func sendToInstance(path string, req *instanceRequest) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req.Version = instanceProtocolVersion
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(conn)
+	want := instanceOK
+	for {
+		var resp instanceResponse
+		if err := dec.Decode(&resp); err != nil {
+			if err == io.EOF && want == instanceDone {
+				// the instance quit, so the views are closed as well
+				return nil
+			}
+			return err
+		}
+		if resp.Version != instanceProtocolVersion {
+			return errInstanceVersion
+		}
+		switch {
+		case resp.Status == instanceErr:
+			return errors.New(resp.Error)
+		case resp.Status != want:
+			return fmt.Errorf("unexpected instance response %q", resp.Status)
+		case want == instanceOK && req.Wait:
+			want = instanceDone
+		default:
+			return nil
+		}
+	}
+}
+
+// isNoInstance reports whether err means nobody is listening on the socket
+func isNoInstance(err error) bool {
+	if err == nil {
+		return false
+	}
+	if os.IsNotExist(err) {
+		return true
+	}
+	if oe, ok := err.(*net.OpError); ok {
+		return oe.Op == "dial"
+	}
+	return false
+}
+
+// listenInstance starts serving requests on path. A stale socket left by a
+// crashed instance is removed first.
+func listenInstance(path string, handle instanceHandler) (*instanceServer, error) {
+	if err := sendToInstance(path, &instanceRequest{}); err == nil || !isNoInstance(err) {
+		return nil, fmt.Errorf("another instance is listening on %s", path)
+	}
+	os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &instanceServer{path: path, ln: ln, handle: handle}
+	go s.serve()
+	return s, nil
+}
+
+func (s *instanceServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *instanceServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	reply := func(status string, err error) {
+		resp := instanceResponse{Version: instanceProtocolVersion, Status: status}
+		if err != nil {
+			resp.Status = instanceErr
+			resp.Error = err.Error()
+		}
+		if err := enc.Encode(&resp); err != nil {
+			log.Warn("Couldn't reply to instance request: %s", err)
+		}
+	}
+
+	var req instanceRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		reply(instanceErr, err)
+		return
+	}
+	if req.Version != instanceProtocolVersion {
+		reply(instanceErr, errInstanceVersion)
+		return
+	}
+	// an empty request is only a probe
+	if req.Args == nil {
+		reply(instanceOK, nil)
+		return
+	}
+
+	done, err := s.handle(&req)
+	if err != nil {
+		reply(instanceErr, err)
+		return
+	}
+	reply(instanceOK, nil)
+	if req.Wait {
+		<-done
+		reply(instanceDone, nil)
+	}
+}
+
+// Close stops listening and removes the socket
+func (s *instanceServer) Close() error {
+	err := s.ln.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// handleInstanceRequest applies the launch args of another invocation, the
+// returned channel is closed once all views opened for it are closed.
+func (f *frontend) handleInstanceRequest(req *instanceRequest) (<-chan struct{}, error) {
+	done := make(chan struct{})
+	// requests come in on the goroutines of their connections, they are
+	// applied on the main loop like the args of our own invocation. The
+	// views are registered there too so none is closed before.
+	qml.RunMain(func() {
+		views := f.applyLaunchArgs(req.Args)
+		if len(views) == 0 {
+			close(done)
+			return
+		}
+
+		f.lock.Lock()
+		for _, bv := range views {
+			f.waiting[bv] = append(f.waiting[bv], done)
+		}
+		f.lock.Unlock()
+	})
+	return done, nil
+}
+
+// doneWaiting is called when bv is closed, it closes the done channels of
+// the instance requests that were only waiting for bv.
+func (f *frontend) doneWaiting(bv *backend.View) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	chans := f.waiting[bv]
+	delete(f.waiting, bv)
+	for _, done := range chans {
+		pending := false
+		for _, other := range f.waiting {
+			for _, c := range other {
+				if c == done {
+					pending = true
+				}
+			}
+		}
+		if !pending {
+			close(done)
+		}
+	}
+}
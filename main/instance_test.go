@@ -0,0 +1,204 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tempSocket(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "lime-instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "lime.sock"), func() { os.RemoveAll(dir) }
+}
+
+func TestInstanceNoInstance(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+
+	err := sendToInstance(path, &instanceRequest{Args: &launchArgs{}})
+	if !isNoInstance(err) {
+		t.Errorf("Expected no instance error, but got %v", err)
+	}
+}
+
+func TestInstanceRequest(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+
+	reqs := make(chan *instanceRequest, 1)
+	srv, err := listenInstance(path, func(req *instanceRequest) (<-chan struct{}, error) {
+		reqs <- req
+		done := make(chan struct{})
+		close(done)
+		return done, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	args := &launchArgs{
+		Files:     []fileLocation{{Path: "/tmp/a.go", Line: 3, Col: 4}},
+		Folders:   []string{"/tmp"},
+		NewWindow: true,
+		Command:   "goto_line",
+	}
+	if err := sendToInstance(path, &instanceRequest{Args: args}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-reqs:
+		if req.Version != instanceProtocolVersion {
+			t.Errorf("Expected version %d, but got %d", instanceProtocolVersion, req.Version)
+		}
+		if !reflect.DeepEqual(req.Args, args) {
+			t.Errorf("Expected args %+v, but got %+v", args, req.Args)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Request wasn't handled")
+	}
+}
+
+func TestInstanceWait(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+
+	done := make(chan struct{})
+	srv, err := listenInstance(path, func(req *instanceRequest) (<-chan struct{}, error) {
+		return done, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	returned := make(chan error, 1)
+	go func() {
+		returned <- sendToInstance(path, &instanceRequest{Args: &launchArgs{}, Wait: true})
+	}()
+
+	select {
+	case err := <-returned:
+		t.Fatalf("Returned before the request was done: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(done)
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Didn't return after the request was done")
+	}
+}
+
+func TestInstanceVersionMismatch(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+
+	srv, err := listenInstance(path, func(req *instanceRequest) (<-chan struct{}, error) {
+		t.Error("Handled a request with the wrong version")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	req := instanceRequest{Version: instanceProtocolVersion + 1, Args: &launchArgs{}}
+	if err := json.NewEncoder(conn).Encode(&req); err != nil {
+		t.Fatal(err)
+	}
+	var resp instanceResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != instanceErr {
+		t.Errorf("Expected status %q, but got %q", instanceErr, resp.Status)
+	}
+}
+
+func TestInstanceStaleSocket(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+
+	// a file nobody listens on, like the socket of a crashed instance
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := listenInstance(path, func(req *instanceRequest) (<-chan struct{}, error) {
+		done := make(chan struct{})
+		close(done)
+		return done, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	if _, err := listenInstance(path, nil); err == nil {
+		t.Error("Expected an error listening twice on the same socket")
+	}
+}
+
+func TestInstanceSocketPath(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "lime-tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("XDG_RUNTIME_DIR", "")
+	os.Setenv("TMPDIR", tmp)
+
+	path, err := instanceSocketPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(path)
+	if filepath.Dir(dir) != tmp {
+		t.Errorf("Expected the socket in a directory of %s, but got %s", tmp, path)
+	}
+	if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("Expected %s to be created 0700, got %v, %v", dir, fi.Mode(), err)
+	}
+	if p, err := instanceSocketPath(); err != nil || p != path {
+		t.Errorf("Expected %s again, but got %s, %v", path, p, err)
+	}
+
+	// a directory others may write to could hold anybody's socket
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instanceSocketPath(); err == nil {
+		t.Error("Expected an error for a directory others may access")
+	}
+	os.Remove(dir)
+	if err := os.Symlink(tmp, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instanceSocketPath(); err == nil {
+		t.Error("Expected an error for a symlink")
+	}
+}
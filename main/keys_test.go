@@ -0,0 +1,432 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/limetext/backend/keys"
+)
+
+// Every Qt key code of a keyboard, with the multimedia keys as examples of
+// those we don't handle
+func TestLookupKey(t *testing.T) {
+	tests := []struct {
+		code int
+		exp  keys.Key
+		ok   bool
+	}{
+		{0x01000000, keys.Escape, true},      // Escape
+		{0x01000001, '\t', true},             // Tab
+		{0x01000002, '\t', true},             // Backtab
+		{0x01000003, keys.Backspace, true},   // Backspace
+		{0x01000004, keys.Enter, true},       // Return
+		{0x01000005, keys.KeypadEnter, true}, // Enter
+		{0x01000006, keys.Insert, true},      // Insert
+		{0x01000007, keys.Delete, true},      // Delete
+		{0x01000008, keys.Break, true},       // Pause
+		{0x01000009, keys.Print, true},       // Print
+		{0x0100000a, keys.SysReq, true},      // SysReq
+		{0x0100000b, keys.Clear, true},       // Clear
+		{0x01000010, keys.Home, true},        // Home
+		{0x01000011, keys.End, true},         // End
+		{0x01000012, keys.Left, true},        // Left
+		{0x01000013, keys.Up, true},          // Up
+		{0x01000014, keys.Right, true},       // Right
+		{0x01000015, keys.Down, true},        // Down
+		{0x01000016, keys.PageUp, true},      // PageUp
+		{0x01000017, keys.PageDown, true},    // PageDown
+		{0x01000020, 0, false},               // Shift
+		{0x01000021, 0, false},               // Control
+		{0x01000022, 0, false},               // Meta
+		{0x01000023, 0, false},               // Alt
+		{0x01000024, 0, false},               // CapsLock
+		{0x01000025, 0, false},               // NumLock
+		{0x01000026, 0, false},               // ScrollLock
+		{0x01000030, keys.F1, true},          // F1
+		{0x01000031, keys.F2, true},          // F2
+		{0x01000032, keys.F3, true},          // F3
+		{0x01000033, keys.F4, true},          // F4
+		{0x01000034, keys.F5, true},          // F5
+		{0x01000035, keys.F6, true},          // F6
+		{0x01000036, keys.F7, true},          // F7
+		{0x01000037, keys.F8, true},          // F8
+		{0x01000038, keys.F9, true},          // F9
+		{0x01000039, keys.F10, true},         // F10
+		{0x0100003a, keys.F11, true},         // F11
+		{0x0100003b, keys.F12, true},         // F12
+		{0x0100003c, keys.F13, true},         // F13
+		{0x0100003d, keys.F14, true},         // F14
+		{0x0100003e, keys.F15, true},         // F15
+		{0x0100003f, keys.F16, true},         // F16
+		{0x01000040, keys.F17, true},         // F17
+		{0x01000041, keys.F18, true},         // F18
+		{0x01000042, keys.F19, true},         // F19
+		{0x01000043, keys.F20, true},         // F20
+		{0x01000044, keys.F21, true},         // F21
+		{0x01000045, keys.F22, true},         // F22
+		{0x01000046, keys.F23, true},         // F23
+		{0x01000047, keys.F24, true},         // F24
+		{0x01000048, keys.F25, true},         // F25
+		{0x01000049, keys.F26, true},         // F26
+		{0x0100004a, keys.F27, true},         // F27
+		{0x0100004b, keys.F28, true},         // F28
+		{0x0100004c, keys.F29, true},         // F29
+		{0x0100004d, keys.F30, true},         // F30
+		{0x0100004e, keys.F31, true},         // F31
+		{0x0100004f, keys.F32, true},         // F32
+		{0x01000050, keys.F33, true},         // F33
+		{0x01000051, keys.F34, true},         // F34
+		{0x01000052, keys.F35, true},         // F35
+		{0x01000053, 0, false},               // Super_L
+		{0x01000054, 0, false},               // Super_R
+		{0x01000055, keys.Menu, true},        // Menu
+		{0x01000056, 0, false},               // Hyper_L
+		{0x01000057, 0, false},               // Hyper_R
+		{0x01000058, keys.Help, true},        // Help
+		{0x01000059, 0, false},               // Direction_L
+		{0x01000060, 0, false},               // Direction_R
+		{0x01001103, 0, false},               // AltGr
+		{0x01001250, 0, false},               // Dead_Grave
+		{0x0100126f, 0, false},               // Dead_Horn
+		{0x01000061, 0, false},               // Back
+		{0x01000070, 0, false},               // VolumeDown
+		{0x010000ff, 0, false},               // unknown
+		{0x01ffffff, 0, false},               // unknown
+		{0x20, ' ', true},
+		{0x21, '!', true},
+		{0x22, '"', true},
+		{0x23, '#', true},
+		{0x24, '$', true},
+		{0x25, '%', true},
+		{0x26, '&', true},
+		{0x27, '\'', true},
+		{0x28, '(', true},
+		{0x29, ')', true},
+		{0x2a, '*', true},
+		{0x2b, '+', true},
+		{0x2c, ',', true},
+		{0x2d, '-', true},
+		{0x2e, '.', true},
+		{0x2f, '/', true},
+		{0x30, '0', true},
+		{0x31, '1', true},
+		{0x32, '2', true},
+		{0x33, '3', true},
+		{0x34, '4', true},
+		{0x35, '5', true},
+		{0x36, '6', true},
+		{0x37, '7', true},
+		{0x38, '8', true},
+		{0x39, '9', true},
+		{0x3a, ':', true},
+		{0x3b, ';', true},
+		{0x3c, '<', true},
+		{0x3d, '=', true},
+		{0x3e, '>', true},
+		{0x3f, '?', true},
+		{0x40, '@', true},
+		{0x41, 'a', true},
+		{0x42, 'b', true},
+		{0x43, 'c', true},
+		{0x44, 'd', true},
+		{0x45, 'e', true},
+		{0x46, 'f', true},
+		{0x47, 'g', true},
+		{0x48, 'h', true},
+		{0x49, 'i', true},
+		{0x4a, 'j', true},
+		{0x4b, 'k', true},
+		{0x4c, 'l', true},
+		{0x4d, 'm', true},
+		{0x4e, 'n', true},
+		{0x4f, 'o', true},
+		{0x50, 'p', true},
+		{0x51, 'q', true},
+		{0x52, 'r', true},
+		{0x53, 's', true},
+		{0x54, 't', true},
+		{0x55, 'u', true},
+		{0x56, 'v', true},
+		{0x57, 'w', true},
+		{0x58, 'x', true},
+		{0x59, 'y', true},
+		{0x5a, 'z', true},
+		{0x5b, '[', true},
+		{0x5c, '\\', true},
+		{0x5d, ']', true},
+		{0x5e, '^', true},
+		{0x5f, '_', true},
+		{0x60, '`', true},
+		{0x61, 'a', true},
+		{0x62, 'b', true},
+		{0x63, 'c', true},
+		{0x64, 'd', true},
+		{0x65, 'e', true},
+		{0x66, 'f', true},
+		{0x67, 'g', true},
+		{0x68, 'h', true},
+		{0x69, 'i', true},
+		{0x6a, 'j', true},
+		{0x6b, 'k', true},
+		{0x6c, 'l', true},
+		{0x6d, 'm', true},
+		{0x6e, 'n', true},
+		{0x6f, 'o', true},
+		{0x70, 'p', true},
+		{0x71, 'q', true},
+		{0x72, 'r', true},
+		{0x73, 's', true},
+		{0x74, 't', true},
+		{0x75, 'u', true},
+		{0x76, 'v', true},
+		{0x77, 'w', true},
+		{0x78, 'x', true},
+		{0x79, 'y', true},
+		{0x7a, 'z', true},
+		{0x7b, '{', true},
+		{0x7c, '|', true},
+		{0x7d, '}', true},
+		{0x7e, '~', true},
+		{0xa0, '\u00a0', true},
+		{0xa1, '¡', true},
+		{0xa2, '¢', true},
+		{0xa3, '£', true},
+		{0xa4, '¤', true},
+		{0xa5, '¥', true},
+		{0xa6, '¦', true},
+		{0xa7, '§', true},
+		{0xa8, '¨', true},
+		{0xa9, '©', true},
+		{0xaa, 'ª', true},
+		{0xab, '«', true},
+		{0xac, '¬', true},
+		{0xad, '\u00ad', true},
+		{0xae, '®', true},
+		{0xaf, '¯', true},
+		{0xb0, '°', true},
+		{0xb1, '±', true},
+		{0xb2, '²', true},
+		{0xb3, '³', true},
+		{0xb4, '´', true},
+		{0xb5, 'µ', true},
+		{0xb6, '¶', true},
+		{0xb7, '·', true},
+		{0xb8, '¸', true},
+		{0xb9, '¹', true},
+		{0xba, 'º', true},
+		{0xbb, '»', true},
+		{0xbc, '¼', true},
+		{0xbd, '½', true},
+		{0xbe, '¾', true},
+		{0xbf, '¿', true},
+		{0xc0, 'à', true},
+		{0xc1, 'á', true},
+		{0xc2, 'â', true},
+		{0xc3, 'ã', true},
+		{0xc4, 'ä', true},
+		{0xc5, 'å', true},
+		{0xc6, 'æ', true},
+		{0xc7, 'ç', true},
+		{0xc8, 'è', true},
+		{0xc9, 'é', true},
+		{0xca, 'ê', true},
+		{0xcb, 'ë', true},
+		{0xcc, 'ì', true},
+		{0xcd, 'í', true},
+		{0xce, 'î', true},
+		{0xcf, 'ï', true},
+		{0xd0, 'ð', true},
+		{0xd1, 'ñ', true},
+		{0xd2, 'ò', true},
+		{0xd3, 'ó', true},
+		{0xd4, 'ô', true},
+		{0xd5, 'õ', true},
+		{0xd6, 'ö', true},
+		{0xd7, '×', true},
+		{0xd8, 'ø', true},
+		{0xd9, 'ù', true},
+		{0xda, 'ú', true},
+		{0xdb, 'û', true},
+		{0xdc, 'ü', true},
+		{0xdd, 'ý', true},
+		{0xde, 'þ', true},
+		{0xdf, 'ß', true},
+		{0xe0, 'à', true},
+		{0xe1, 'á', true},
+		{0xe2, 'â', true},
+		{0xe3, 'ã', true},
+		{0xe4, 'ä', true},
+		{0xe5, 'å', true},
+		{0xe6, 'æ', true},
+		{0xe7, 'ç', true},
+		{0xe8, 'è', true},
+		{0xe9, 'é', true},
+		{0xea, 'ê', true},
+		{0xeb, 'ë', true},
+		{0xec, 'ì', true},
+		{0xed, 'í', true},
+		{0xee, 'î', true},
+		{0xef, 'ï', true},
+		{0xf0, 'ð', true},
+		{0xf1, 'ñ', true},
+		{0xf2, 'ò', true},
+		{0xf3, 'ó', true},
+		{0xf4, 'ô', true},
+		{0xf5, 'õ', true},
+		{0xf6, 'ö', true},
+		{0xf7, '÷', true},
+		{0xf8, 'ø', true},
+		{0xf9, 'ù', true},
+		{0xfa, 'ú', true},
+		{0xfb, 'û', true},
+		{0xfc, 'ü', true},
+		{0xfd, 'ý', true},
+		{0xfe, 'þ', true},
+		{0xff, 'ÿ', true},
+	}
+
+	for i, test := range tests {
+		k, ok := lookupKey(test.code, 0)
+		if ok != test.ok {
+			t.Errorf("Test %d: Expected %#x to be found: %v, but got %v", i, test.code, test.ok, ok)
+		} else if ok && k != test.exp {
+			t.Errorf("Test %d: Expected %#x to be %q, but got %q", i, test.code, test.exp, k)
+		}
+	}
+}
+
+// The keys typed on the keypad, with keypad_mod set, which are told apart
+// from those of the main row
+func TestLookupKeypadKey(t *testing.T) {
+	tests := []struct {
+		code int
+		exp  keys.Key
+	}{
+		{0x30, keys.Keypad0},
+		{0x31, keys.Keypad1},
+		{0x32, keys.Keypad2},
+		{0x33, keys.Keypad3},
+		{0x34, keys.Keypad4},
+		{0x35, keys.Keypad5},
+		{0x36, keys.Keypad6},
+		{0x37, keys.Keypad7},
+		{0x38, keys.Keypad8},
+		{0x39, keys.Keypad9},
+		{0x2e, keys.KeypadPeriod},
+		{0x2f, keys.KeypadDivide},
+		{0x2a, keys.KeypadMultiply},
+		{0x2d, keys.KeypadMinus},
+		{0x2b, keys.KeypadPlus},
+		{0x3d, keys.KeypadEquals},
+		{0x01000005, keys.KeypadEnter},
+		{0x0100000b, keys.Clear},
+	}
+	for i, test := range tests {
+		k, ok := lookupKey(test.code, keypad_mod)
+		if !ok || k != test.exp {
+			t.Errorf("Test %d: Expected %#x on the keypad to be %q, but got %q, %v", i, test.code, test.exp, k, ok)
+		}
+		if main, _ := lookupKey(test.code, 0); test.code < qtKeySpecial && main == k {
+			t.Errorf("Test %d: Expected %#x on the keypad to differ from the main row's %q", i, test.code, main)
+		}
+	}
+}
+
+func TestTypeKeypadKey(t *testing.T) {
+	bound := func(keys.KeyPress) bool { return true }
+	unbound := func(keys.KeyPress) bool { return false }
+	tests := []struct {
+		kp    keys.KeyPress
+		bound func(keys.KeyPress) bool
+		exp   keys.Key
+	}{
+		{keys.KeyPress{Key: keys.Keypad1, Text: "1"}, unbound, '1'},
+		{keys.KeyPress{Key: keys.KeypadPlus, Text: "+"}, unbound, '+'},
+		{keys.KeyPress{Key: keys.Keypad1, Text: "1"}, bound, keys.Keypad1},
+		{keys.KeyPress{Key: keys.Keypad1, Ctrl: true}, unbound, keys.Keypad1},
+		{keys.KeyPress{Key: '1', Text: "1"}, unbound, '1'},
+		{keys.KeyPress{Key: keys.KeypadEnter, Text: "\r"}, unbound, keys.KeypadEnter},
+	}
+	for i, test := range tests {
+		if kp := typeKeypadKey(test.kp, test.bound); kp.Key != test.exp {
+			t.Errorf("Test %d: Expected %q, but got %q", i, test.exp, kp.Key)
+		}
+	}
+}
+
+func TestKeyPress(t *testing.T) {
+	tests := []struct {
+		text string
+		code int
+		mods int
+		exp  keys.Key
+		alt  bool
+	}{
+		// latin-1 letters from the lut
+		{"é", 0xc9, 0, 'é', false},
+		{"É", 0xc9, shift_mod, 'é', false},
+		// letters of layouts the lut doesn't know
+		{"ж", 0x416, 0, 'ж', false},
+		{"λ", 0x39b, 0, 'λ', false},
+		{"ß", 0x1e9e, 0, 'ß', false},
+		// no text with ctrl, the code point is used instead
+		{"", 0x416, ctrl_mod, 'ж', false},
+		{"\x01", 0x41, ctrl_mod, 'a', false},
+		// composed characters, where qt reports the base key
+		{"é", 0x45, 0, 'é', false},
+		{"ñ", 0x4e, 0, 'ñ', false},
+		// altgr, which shows up as ctrl+alt on windows
+		{"@", 0x51, ctrl_mod | alt_mod, '@', false},
+		{"€", 0x45, ctrl_mod | alt_mod, '€', false},
+		// alt bindings still resolve
+		{"", 0x58, alt_mod, 'x', true},
+		// keypad keys keep their own key
+		{"5", 0x35, keypad_mod, keys.Keypad5, false},
+		{"+", 0x2b, keypad_mod, keys.KeypadPlus, false},
+		{"", 0x01000005, keypad_mod, keys.KeypadEnter, false},
+		{"", 0x35, keypad_mod | ctrl_mod, keys.Keypad5, false},
+		// without numlock the keypad sends the keys it's labelled with
+		{"", 0x01000010, keypad_mod, keys.Home, false},
+	}
+
+	for i, test := range tests {
+		kp, ok := keyPress(test.text, test.code, test.mods, defaultModifierMap("linux"))
+		if !ok {
+			t.Errorf("Test %d: Expected %q (%#x) to be handled", i, test.text, test.code)
+			continue
+		}
+		if kp.Key != test.exp {
+			t.Errorf("Test %d: Expected key %q, but got %q", i, test.exp, kp.Key)
+		}
+		if kp.Alt != test.alt {
+			t.Errorf("Test %d: Expected alt to be %v, but got %v", i, test.alt, kp.Alt)
+		}
+		if kp.Text != test.text {
+			t.Errorf("Test %d: Expected text %q, but got %q", i, test.text, kp.Text)
+		}
+	}
+}
+
+func TestKeyPressUnhandled(t *testing.T) {
+	// modifiers on their own and unprintable keys without text
+	for _, code := range []int{0x01000020, 0x01001103, 0x010000ff} {
+		if kp, ok := keyPress("", code, 0, defaultModifierMap("linux")); ok {
+			t.Errorf("Expected %#x not to be handled, but got %v", code, kp)
+		}
+	}
+}
+
+func TestDeadKeys(t *testing.T) {
+	// Qt::Key_Dead_Grave, Qt::Key_Dead_Acute and Qt::Key_Dead_Diaeresis
+	for _, code := range []int{0x01001250, 0x01001251, 0x01001257} {
+		if !isDeadKey(code) {
+			t.Errorf("Expected %#x to be a dead key", code)
+		}
+	}
+	if isDeadKey(0x41) {
+		t.Error("Expected 'A' not to be a dead key")
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/limetext/backend"
+)
+
+type (
+	// layout is the arrangement of a window's groups in the format of
+	// set_layout. Cols and Rows are the fractions of the window's width and
+	// height where cells start and end, each cell is the [x1, y1, x2, y2]
+	// indices of its edges in them.
+	layout struct {
+		Cols  []float64 `json:"cols"`
+		Rows  []float64 `json:"rows"`
+		Cells [][]int   `json:"cells"`
+	}
+
+	// SetLayoutCommand changes the window's layout, the views of removed
+	// groups are moved to the last remaining one
+	SetLayoutCommand struct {
+		backend.DefaultCommand
+		layout layout
+	}
+
+	// FocusGroupCommand makes the active view of a group the window's active
+	// view
+	FocusGroupCommand struct {
+		backend.DefaultCommand
+		Group int
+	}
+
+	// MoveToGroupCommand moves the active view to another group
+	MoveToGroupCommand struct {
+		backend.DefaultCommand
+		Group int
+	}
+)
+
+// defaultLayout is a single group filling the window
+func defaultLayout() layout {
+	return layout{
+		Cols:  []float64{0, 1},
+		Rows:  []float64{0, 1},
+		Cells: [][]int{{0, 0, 1, 1}},
+	}
+}
+
+// check returns an error if l isn't a usable layout
+func (l *layout) check() error {
+	if len(l.Cells) == 0 {
+		return errors.New("layout without cells")
+	}
+	for _, c := range l.Cells {
+		if len(c) != 4 {
+			return fmt.Errorf("invalid cell %v", c)
+		}
+		if c[0] < 0 || c[0] >= c[2] || c[2] >= len(l.Cols) ||
+			c[1] < 0 || c[1] >= c[3] || c[3] >= len(l.Rows) {
+			return fmt.Errorf("cell %v out of range", c)
+		}
+	}
+	return nil
+}
+
+func (l *layout) json() string {
+	data, _ := json.Marshal(l)
+	return string(data)
+}
+
+// intValue returns v as an int, numbers coming from json or javascript may
+// be floats
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// intArg returns the arg name as an int
+func intArg(args backend.Args, name string) (int, error) {
+	if n, ok := intValue(args[name]); ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s should be a number: %v", name, args[name])
+}
+
+func (c *SetLayoutCommand) Init(args backend.Args) error {
+	// the args are json-like already, so let json sort out the types
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	c.layout = layout{}
+	if err := json.Unmarshal(data, &c.layout); err != nil {
+		return err
+	}
+	return c.layout.check()
+}
+
+func (c *SetLayoutCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil {
+		w.setLayout(c.layout)
+	}
+	return nil
+}
+
+func (c *FocusGroupCommand) Init(args backend.Args) (err error) {
+	c.Group, err = intArg(args, "group")
+	return
+}
+
+func (c *FocusGroupCommand) Run(bw *backend.Window) error {
+	if w := fe.window(bw); w != nil {
+		w.focusGroup(c.Group)
+	}
+	return nil
+}
+
+func (c *MoveToGroupCommand) Init(args backend.Args) (err error) {
+	c.Group, err = intArg(args, "group")
+	return
+}
+
+func (c *MoveToGroupCommand) Run(bw *backend.Window) error {
+	w := fe.window(bw)
+	if w == nil || bw.ActiveView() == nil {
+		return nil
+	}
+	w.moveToGroup(bw.ActiveView(), c.Group)
+	return nil
+}
+
+// findView returns the group of bv and its index in the group, or -1, -1 if
+// bv isn't in any group. The caller holds groupsLock.
+func (w *window) findView(bv *backend.View) (group, index int) {
+	for g, views := range w.groups {
+		for i, v := range views {
+			if v == bv {
+				return g, i
+			}
+		}
+	}
+	return -1, -1
+}
+
+// viewIndex returns the group of bv and its index in the group
+func (w *window) viewIndex(bv *backend.View) (group, index int) {
+	w.groupsLock.Lock()
+	defer w.groupsLock.Unlock()
+	return w.findView(bv)
+}
+
+// ViewIndex returns the group of bv and its index in the group, or -1, -1,
+// for window.get_view_index
+func (f *frontend) ViewIndex(bv *backend.View) (group, index int) {
+	w := f.window(bv.Window())
+	if w == nil {
+		return -1, -1
+	}
+	return w.viewIndex(bv)
+}
+
+// ActiveGroup returns the active group of bw, for window.active_group
+func (f *frontend) ActiveGroup(bw *backend.Window) int {
+	w := f.window(bw)
+	if w == nil {
+		return 0
+	}
+	w.groupsLock.Lock()
+	defer w.groupsLock.Unlock()
+	return w.activeGroup
+}
+
+// ViewsInGroup returns the views of group of bw in tab order, for
+// window.views_in_group
+func (f *frontend) ViewsInGroup(bw *backend.Window, group int) []*backend.View {
+	w := f.window(bw)
+	if w == nil {
+		return nil
+	}
+	w.groupsLock.Lock()
+	defer w.groupsLock.Unlock()
+	if group < 0 || group >= len(w.groups) {
+		return nil
+	}
+	return append([]*backend.View(nil), w.groups[group]...)
+}
+
+// addView adds bv to the end of group, or of the active group if group
+// doesn't exist, and returns the group it was added to. Views that are in a
+// group already, as when the qml is reloaded, stay where they are.
+func (w *window) addView(bv *backend.View, group int) int {
+	w.groupsLock.Lock()
+	defer w.groupsLock.Unlock()
+	if g, _ := w.findView(bv); g >= 0 {
+		return g
+	}
+	if group < 0 || group >= len(w.groups) {
+		group = w.activeGroup
+	}
+	w.groups[group] = append(w.groups[group], bv)
+	return group
+}
+
+// removeView removes bv from its group
+func (w *window) removeView(bv *backend.View) {
+	w.groupsLock.Lock()
+	g, i := w.findView(bv)
+	if g >= 0 {
+		w.groups[g] = append(w.groups[g][:i], w.groups[g][i+1:]...)
+	}
+	w.groupsLock.Unlock()
+}
+
+// activated makes the group of bv the active group, for views activated by
+// clicking into them or by plugins
+func (w *window) activated(bv *backend.View) {
+	w.groupsLock.Lock()
+	g, _ := w.findView(bv)
+	changed := g >= 0 && g != w.activeGroup
+	if changed {
+		w.activeGroup = g
+	}
+	w.groupsLock.Unlock()
+	if changed && w.qw != nil {
+		w.qw.Call("focusGroup", g)
+	}
+}
+
+// setLayout applies l, the views of groups l doesn't have anymore are
+// moved to its last group
+func (w *window) setLayout(l layout) {
+	w.groupsLock.Lock()
+	n := len(l.Cells)
+	var moved []*backend.View
+	if n < len(w.groups) {
+		for _, views := range w.groups[n:] {
+			moved = append(moved, views...)
+		}
+	}
+	groups := make([][]*backend.View, n)
+	copy(groups, w.groups)
+	groups[n-1] = append(groups[n-1], moved...)
+	w.groups = groups
+	w.layout = l
+	if w.activeGroup >= n {
+		w.activeGroup = n - 1
+	}
+	active := w.activeGroup
+	w.groupsLock.Unlock()
+
+	if w.qw != nil {
+		for _, bv := range moved {
+			if v := w.view(bv); v != nil {
+				w.qw.Call("moveTab", v.id, n-1, -1)
+			}
+		}
+		w.qw.Call("setLayout", l.json())
+	}
+	w.focusGroup(active)
+}
+
+// focusGroup makes group the active group, its current tab becomes the
+// active view
+func (w *window) focusGroup(group int) {
+	w.groupsLock.Lock()
+	if group < 0 || group >= len(w.groups) {
+		w.groupsLock.Unlock()
+		return
+	}
+	w.activeGroup = group
+	w.groupsLock.Unlock()
+	if w.qw != nil {
+		w.qw.Call("focusGroup", group)
+	}
+}
+
+// moveToGroup moves bv to the end of group and activates it there
+func (w *window) moveToGroup(bv *backend.View, group int) {
+	w.setViewIndex(bv, group, -1)
+}
+
+// setViewIndex moves bv to index in group, or to the end of group if index
+// is out of range, and activates it there
+func (w *window) setViewIndex(bv *backend.View, group, index int) {
+	w.groupsLock.Lock()
+	g, i := w.findView(bv)
+	if g < 0 || group < 0 || group >= len(w.groups) {
+		w.groupsLock.Unlock()
+		return
+	}
+	w.groups[g] = append(w.groups[g][:i], w.groups[g][i+1:]...)
+	views := w.groups[group]
+	if index < 0 || index > len(views) {
+		index = len(views)
+	}
+	views = append(views, nil)
+	copy(views[index+1:], views[index:])
+	views[index] = bv
+	w.groups[group] = views
+	w.activeGroup = group
+	w.groupsLock.Unlock()
+
+	if v := w.view(bv); v != nil && w.qw != nil {
+		w.qw.Call("moveTab", v.id, group, index)
+		w.qw.Call("activateTab", v.id)
+	}
+}
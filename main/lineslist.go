@@ -82,6 +82,9 @@ type lineStruct struct {
 	Chunks   []lineChunk
 	Width    int
 	Measured bool
+	// Version is bumped whenever the chunks change so qml knows to repaint
+	// the line even if its text stayed the same
+	Version int
 }
 
 func (l *lineStruct) ChunksLen() int {
@@ -99,7 +102,9 @@ type lineChunk struct {
 	Text       string
 	Background string
 	Foreground string
-	SkipWidth  int
-	Width      int
-	Measured   bool
+	// Match is set for chunks that are part of a search match
+	Match     bool
+	SkipWidth int
+	Width     int
+	Measured  bool
 }
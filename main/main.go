@@ -6,6 +6,8 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
 	"runtime"
 
 	"github.com/limetext/backend/log"
@@ -15,10 +17,39 @@ import (
 	_ "github.com/limetext/sublime"
 )
 
-var rotateLog = flag.Bool("rotateLog", false, "Rotate debug log")
+var (
+	rotateLog   = flag.Bool("rotateLog", false, "Rotate debug log")
+	inNewWindow = flag.Bool("new-window", false, "Open the given files and folders in a new window")
+	addFolders  = flag.Bool("add", false, "Add the given folders to the current window")
+	command     = flag.String("command", "", "Run a command on startup, its json args may follow as the next argument")
+	wait        = flag.Bool("wait", false, "Wait for the files to be closed before returning")
+)
+
+// files, folders and command given on the command line
+var launch *launchArgs
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [path[:line[:col]]...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+	var err error
+	if launch, err = parseLaunchArgs(flag.Args(), *inNewWindow, *addFolders, *command); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// hand everything over to an already running instance if there is one
+	if path, err := instanceSocketPath(); err != nil {
+		fmt.Fprintf(os.Stderr, "Not looking for a running instance: %s\n", err)
+	} else if err := sendToInstance(path, &instanceRequest{Args: launch, Wait: *wait}); err == nil {
+		return
+	} else if !isNoInstance(err) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	// Need to lock the OS thread as OSX GUI requires GUI stuff to run in the main thread
 	runtime.LockOSThread()
 
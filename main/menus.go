@@ -0,0 +1,338 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+)
+
+// menuItem is an entry of a .sublime-menu file. Items with children are
+// submenus, items with a "-" caption are separators.
+type menuItem struct {
+	Id       string       `json:"id"`
+	Caption  string       `json:"caption"`
+	Command  string       `json:"command"`
+	Args     backend.Args `json:"args"`
+	Checkbox bool         `json:"checkbox"`
+	Mnemonic string       `json:"mnemonic"`
+	Children []*menuItem  `json:"children"`
+
+	// set for context menus, whose commands apply to the clicked view
+	ctx *menuContext
+	// overrides asking the command whether it's checked, for menus built
+	// by the frontend
+	checked func() bool
+}
+
+// menuContext is the view a context or status bar menu was opened for
+type menuContext struct {
+	bv *backend.View
+	// the click position passed to the commands as the event arg, nil for
+	// status bar menus
+	event map[string]interface{}
+}
+
+// defaultMainMenu is used when no package provides a Main.sublime-menu
+const defaultMainMenu = `[
+	{"caption": "File", "mnemonic": "F", "id": "file", "children": [
+		{"command": "new_file", "caption": "New File"},
+		{"command": "prompt_open_file", "caption": "Open File..."},
+		{"command": "save", "caption": "Save"},
+		{"command": "prompt_save_as", "caption": "Save As..."},
+		{"command": "save_all", "caption": "Save All"},
+		{"caption": "-"},
+		{"command": "new_window", "caption": "New Window"},
+		{"command": "close_window", "caption": "Close Window"},
+		{"caption": "-"},
+		{"command": "close", "caption": "Close File"},
+		{"command": "close_all", "caption": "Close All Files"},
+		{"caption": "-", "id": "exit"},
+		{"command": "exit", "caption": "Quit"}
+	]},
+	{"caption": "Edit", "mnemonic": "E", "id": "edit", "children": [
+		{"command": "undo", "caption": "Undo"},
+		{"command": "redo", "caption": "Redo"},
+		{"caption": "Undo Selection", "children": [
+			{"command": "soft_undo", "caption": "Soft Undo"},
+			{"command": "soft_redo", "caption": "Soft Redo"}
+		]},
+		{"caption": "-", "id": "clipboard"},
+		{"command": "copy", "caption": "Copy"},
+		{"command": "cut", "caption": "Cut"},
+		{"command": "paste", "caption": "Paste"}
+	]},
+	{"caption": "Find", "mnemonic": "i", "id": "find", "children": [
+		{"command": "show_panel", "args": {"panel": "find"}, "caption": "Find..."},
+		{"command": "find_panel_next", "caption": "Find Next"},
+		{"command": "find_panel_prev", "caption": "Find Previous"},
+		{"command": "find_panel_all", "caption": "Find All"},
+		{"caption": "-", "id": "replace"},
+		{"command": "show_panel", "args": {"panel": "replace"}, "caption": "Replace..."},
+		{"caption": "-", "id": "find_in_files"},
+		{"command": "show_panel", "args": {"panel": "find_in_files"}, "caption": "Find in Files..."}
+	]},
+	{"caption": "View", "mnemonic": "V", "id": "view", "children": [
+		{"command": "show_overlay", "args": {"overlay": "command_palette"}, "caption": "Command Palette..."},
+		{"command": "show_overlay", "args": {"overlay": "goto"}, "caption": "Goto Anything..."},
+		{"caption": "-", "id": "toggles"},
+		{"command": "show_panel", "args": {"panel": "console", "toggle": true}, "caption": "Show Console"},
+		{"command": "toggle_minimap", "caption": "Show Minimap", "checkbox": true},
+		{"command": "toggle_status_bar", "caption": "Show Status Bar", "checkbox": true},
+		{"caption": "-", "id": "layout"},
+		{"caption": "Layout", "mnemonic": "L", "children": [
+			{"command": "set_layout", "caption": "Single",
+				"args": {"cols": [0.0, 1.0], "rows": [0.0, 1.0], "cells": [[0, 0, 1, 1]]}},
+			{"command": "set_layout", "caption": "Columns: 2",
+				"args": {"cols": [0.0, 0.5, 1.0], "rows": [0.0, 1.0], "cells": [[0, 0, 1, 1], [1, 0, 2, 1]]}},
+			{"command": "set_layout", "caption": "Rows: 2",
+				"args": {"cols": [0.0, 1.0], "rows": [0.0, 0.5, 1.0], "cells": [[0, 0, 1, 1], [0, 1, 1, 2]]}},
+			{"command": "set_layout", "caption": "Grid: 4",
+				"args": {"cols": [0.0, 0.5, 1.0], "rows": [0.0, 0.5, 1.0], "cells": [[0, 0, 1, 1], [1, 0, 2, 1], [0, 1, 1, 2], [1, 1, 2, 2]]}}
+		]},
+		{"caption": "Focus Group", "children": [
+			{"command": "focus_group", "args": {"group": 0}, "caption": "Group 1"},
+			{"command": "focus_group", "args": {"group": 1}, "caption": "Group 2"},
+			{"command": "focus_group", "args": {"group": 2}, "caption": "Group 3"},
+			{"command": "focus_group", "args": {"group": 3}, "caption": "Group 4"}
+		]},
+		{"caption": "Move File To Group", "children": [
+			{"command": "move_to_group", "args": {"group": 0}, "caption": "Group 1"},
+			{"command": "move_to_group", "args": {"group": 1}, "caption": "Group 2"},
+			{"command": "move_to_group", "args": {"group": 2}, "caption": "Group 3"},
+			{"command": "move_to_group", "args": {"group": 3}, "caption": "Group 4"}
+		]}
+	]}
+]`
+
+// loadMenu returns the merged menu items of the name.sublime-menu files of
+// all packages, or those of def if there are none
+func loadMenu(name, def string) []*menuItem {
+	var items []*menuItem
+	files := packageFiles(name + ".sublime-menu")
+	for _, fn := range files {
+		var add []*menuItem
+		if err := loadJSON(fn, &add); err != nil {
+			log.Warn("Couldn't load %s: %s", fn, err)
+			continue
+		}
+		items = mergeMenu(items, add)
+	}
+	if len(files) == 0 && def != "" {
+		if err := json.Unmarshal([]byte(def), &items); err != nil {
+			log.Error("Couldn't load the default %s menu: %s", name, err)
+		}
+	}
+	return items
+}
+
+// mergeMenu merges the items of add into items. Items with the id of an
+// existing one are merged into it, all others are appended.
+func mergeMenu(items, add []*menuItem) []*menuItem {
+	for _, a := range add {
+		var dst *menuItem
+		if a.Id != "" {
+			for _, it := range items {
+				if it.Id == a.Id {
+					dst = it
+					break
+				}
+			}
+		}
+		if dst == nil {
+			items = append(items, a)
+			continue
+		}
+		if a.Caption != "" {
+			dst.Caption = a.Caption
+		}
+		if a.Command != "" {
+			dst.Command = a.Command
+			dst.Args = a.Args
+		}
+		if a.Mnemonic != "" {
+			dst.Mnemonic = a.Mnemonic
+		}
+		dst.Checkbox = dst.Checkbox || a.Checkbox
+		dst.Children = mergeMenu(dst.Children, a.Children)
+	}
+	return items
+}
+
+// Text returns the caption to show, with the mnemonic marked for qml
+func (m *menuItem) Text() string {
+	caption := m.Caption
+	if caption == "" {
+		caption = commandCaption(m.Command)
+	}
+	caption = strings.Replace(caption, "&", "&&", -1)
+	if m.Mnemonic == "" {
+		return caption
+	}
+	i := strings.Index(caption, m.Mnemonic)
+	if i < 0 {
+		i = strings.Index(strings.ToLower(caption), strings.ToLower(m.Mnemonic))
+	}
+	if i < 0 {
+		return caption
+	}
+	return caption[:i] + "&" + caption[i:]
+}
+
+func (m *menuItem) IsSeparator() bool {
+	return m.Caption == "-"
+}
+
+func (m *menuItem) ChildrenLen() int {
+	return len(m.Children)
+}
+
+func (m *menuItem) Child(i int) *menuItem {
+	return m.Children[i]
+}
+
+// args returns the args to run the item's command with. Context menu
+// commands get the click position as "event" and tab context menu commands
+// get the group and index of the tab for the ones set to -1.
+func (m *menuItem) args() backend.Args {
+	args := make(backend.Args)
+	for k, v := range m.Args {
+		args[k] = v
+	}
+	if m.ctx == nil {
+		return args
+	}
+	if m.ctx.event != nil {
+		args["event"] = m.ctx.event
+	}
+	group, index := viewIndex(m.ctx.bv)
+	if isUnset(args["group"]) {
+		args["group"] = group
+	}
+	if isUnset(args["index"]) {
+		args["index"] = index
+	}
+	return args
+}
+
+// isUnset reports whether a group or index arg was left for us to fill in
+func isUnset(v interface{}) bool {
+	switch n := v.(type) {
+	case float64:
+		return n == -1
+	case int:
+		return n == -1
+	}
+	return false
+}
+
+// viewIndex returns the group of bv and its index within the group
+func viewIndex(bv *backend.View) (group, index int) {
+	if w := fe.window(bv.Window()); w != nil {
+		return w.viewIndex(bv)
+	}
+	return -1, -1
+}
+
+// setContext makes m and its children apply to the view in ctx
+func (m *menuItem) setContext(ctx *menuContext) {
+	m.ctx = ctx
+	for _, c := range m.Children {
+		c.setContext(ctx)
+	}
+}
+
+// target returns the view and window the item's command applies to, nil
+// for the active ones
+func (m *menuItem) target() (*backend.View, *backend.Window) {
+	if m.ctx == nil {
+		return nil, nil
+	}
+	return m.ctx.bv, m.ctx.bv.Window()
+}
+
+// IsEnabled is called from QML when the menu holding the item is opened
+func (m *menuItem) IsEnabled() bool {
+	if m.Command == "" {
+		return true
+	}
+	bv, bw := m.target()
+	return commandEnabled(m.Command, m.args(), bv, bw)
+}
+
+// IsChecked is called from QML when the menu holding the item is opened
+func (m *menuItem) IsChecked() bool {
+	if m.checked != nil {
+		return m.Checkbox && m.checked()
+	}
+	bv, bw := m.target()
+	return m.Checkbox && commandChecked(m.Command, m.args(), bv, bw)
+}
+
+// IsVisible is called from QML when the menu holding the item is opened
+func (m *menuItem) IsVisible() bool {
+	if m.Command == "" {
+		return true
+	}
+	bv, bw := m.target()
+	return commandVisible(m.Command, m.args(), bv, bw)
+}
+
+// Run is called from QML when the item is picked
+func (m *menuItem) Run() {
+	switch {
+	case m.Command == "":
+	case m.ctx != nil:
+		go runCommandOn(m.ctx.bv, m.Command, m.args())
+	default:
+		fe.RunCommandWithArgs(m.Command, m.args())
+	}
+}
+
+// runCommandOn runs the command against bv instead of the active view, for
+// context menus of views that aren't active like the console
+func runCommandOn(bv *backend.View, name string, args backend.Args) {
+	ed := backend.GetEditor()
+	ch := ed.CommandHandler()
+	var err error
+	switch lookupCommand(name).(type) {
+	case backend.TextCommand:
+		err = ch.RunTextCommand(bv, name, args)
+	case backend.WindowCommand:
+		bw := bv.Window()
+		if bw == nil {
+			bw = ed.ActiveWindow()
+		}
+		err = ch.RunWindowCommand(bw, name, args)
+	default:
+		ed.RunCommand(name, args)
+	}
+	if err != nil {
+		log.Error("Couldn't run %s: %s", name, err)
+	}
+}
+
+// ContextMenu is called from QML to get the context menu called name, like
+// "Context" or "Tab Context", for a click at x, y. That's in the view's
+// layout, relative to the top left of its text, or in the window for clicks
+// on the tab.
+func (v *view) ContextMenu(name string, x, y float64) *menuItem {
+	m := fe.Menu(name)
+	m.setContext(&menuContext{bv: v.bv, event: map[string]interface{}{"x": x, "y": y}})
+	return m
+}
+
+// Menu is called from QML to get the menu called name, like "Main", as the
+// children of a single item
+func (f *frontend) Menu(name string) *menuItem {
+	def := ""
+	if name == "Main" {
+		def = defaultMainMenu
+	}
+	return &menuItem{Caption: name, Children: loadMenu(name, def)}
+}
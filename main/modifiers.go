@@ -0,0 +1,104 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"runtime"
+
+	"github.com/limetext/backend/keys"
+	"github.com/limetext/backend/log"
+	. "github.com/limetext/text"
+)
+
+// Qt::GroupSwitchModifier, which is what AltGr sets on X11
+const altgr_mod = 0x40000000
+
+// The Qt modifiers that can be remapped, by their name in the modifier_map
+// setting. Note that on OS X Qt reports the command key as ctrl and the
+// control key as meta.
+var qtModifiers = []struct {
+	name string
+	mod  int
+}{
+	{"ctrl", ctrl_mod},
+	{"alt", alt_mod},
+	{"meta", meta_mod},
+	{"altgr", altgr_mod},
+}
+
+// modifierMap maps the names of Qt modifiers to the key press modifier they
+// turn into, one of "ctrl", "alt", "super" or "" for none
+type modifierMap map[string]string
+
+// defaultModifierMap returns the mapping used on goos unless the
+// modifier_map setting says otherwise. AltGr only changes the character
+// typed, so it maps to nothing by default.
+func defaultModifierMap(goos string) modifierMap {
+	m := modifierMap{"ctrl": "ctrl", "alt": "alt", "meta": "super", "altgr": ""}
+	if goos == "darwin" {
+		// command is the key most bindings use
+		m["ctrl"] = "super"
+		m["meta"] = "ctrl"
+	}
+	return m
+}
+
+// parseModifierMap returns the default mapping with the entries of the
+// modifier_map setting value v applied, e.g. {"ctrl": "super", "meta": "ctrl"}
+// to swap ctrl and super. Unknown names are logged and ignored.
+func parseModifierMap(v interface{}, def modifierMap) modifierMap {
+	m := make(modifierMap, len(def))
+	for k, v := range def {
+		m[k] = v
+	}
+	setting, ok := v.(map[string]interface{})
+	if !ok {
+		return m
+	}
+	for from, to := range setting {
+		if _, ok := m[from]; !ok {
+			log.Warn("modifier_map: unknown modifier %q", from)
+			continue
+		}
+		s, ok := to.(string)
+		switch {
+		case !ok:
+			log.Warn("modifier_map: unknown modifier %v for %q", to, from)
+			continue
+		case s == "none":
+			s = ""
+		case s == "", s == "ctrl", s == "alt", s == "super":
+		default:
+			log.Warn("modifier_map: unknown modifier %q for %q", to, from)
+			continue
+		}
+		m[from] = s
+	}
+	return m
+}
+
+// modifierMapSetting returns the mapping of the modifier_map setting
+func modifierMapSetting(s *Settings) modifierMap {
+	return parseModifierMap(s.Get("modifier_map", nil), defaultModifierMap(runtime.GOOS))
+}
+
+// apply sets the modifiers of kp from the Qt modifiers. Shift is never
+// remapped.
+func (m modifierMap) apply(kp *keys.KeyPress, modifiers int) {
+	kp.Shift = modifiers&shift_mod != 0
+	for _, q := range qtModifiers {
+		if modifiers&q.mod == 0 {
+			continue
+		}
+		switch m[q.name] {
+		case "ctrl":
+			kp.Ctrl = true
+		case "alt":
+			kp.Alt = true
+		case "super":
+			kp.Super = true
+		}
+	}
+}
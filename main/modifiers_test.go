@@ -0,0 +1,111 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/limetext/backend/keys"
+)
+
+func TestModifierMapApply(t *testing.T) {
+	linux := defaultModifierMap("linux")
+	darwin := defaultModifierMap("darwin")
+	swapped := parseModifierMap(map[string]interface{}{"ctrl": "super", "meta": "ctrl"}, linux)
+	altSuper := parseModifierMap(map[string]interface{}{"alt": "super", "meta": "alt"}, linux)
+	altgr := parseModifierMap(map[string]interface{}{"altgr": "alt"}, linux)
+	noAlt := parseModifierMap(map[string]interface{}{"alt": "none"}, linux)
+
+	tests := []struct {
+		m    modifierMap
+		mods int
+		exp  keys.KeyPress
+	}{
+		{linux, 0, keys.KeyPress{}},
+		{linux, shift_mod, keys.KeyPress{Shift: true}},
+		{linux, ctrl_mod, keys.KeyPress{Ctrl: true}},
+		{linux, alt_mod, keys.KeyPress{Alt: true}},
+		{linux, meta_mod, keys.KeyPress{Super: true}},
+		{linux, altgr_mod, keys.KeyPress{}},
+		{linux, ctrl_mod | shift_mod, keys.KeyPress{Ctrl: true, Shift: true}},
+		{linux, ctrl_mod | alt_mod | meta_mod, keys.KeyPress{Ctrl: true, Alt: true, Super: true}},
+		{darwin, ctrl_mod, keys.KeyPress{Super: true}},
+		{darwin, meta_mod, keys.KeyPress{Ctrl: true}},
+		{darwin, alt_mod, keys.KeyPress{Alt: true}},
+		{darwin, ctrl_mod | meta_mod, keys.KeyPress{Ctrl: true, Super: true}},
+		{swapped, ctrl_mod, keys.KeyPress{Super: true}},
+		{swapped, meta_mod, keys.KeyPress{Ctrl: true}},
+		{swapped, alt_mod | shift_mod, keys.KeyPress{Alt: true, Shift: true}},
+		{altSuper, alt_mod, keys.KeyPress{Super: true}},
+		{altSuper, meta_mod, keys.KeyPress{Alt: true}},
+		{altSuper, ctrl_mod, keys.KeyPress{Ctrl: true}},
+		{altgr, altgr_mod, keys.KeyPress{Alt: true}},
+		{altgr, altgr_mod | alt_mod, keys.KeyPress{Alt: true}},
+		{noAlt, alt_mod, keys.KeyPress{}},
+		{noAlt, alt_mod | ctrl_mod, keys.KeyPress{Ctrl: true}},
+	}
+
+	for i, test := range tests {
+		var kp keys.KeyPress
+		test.m.apply(&kp, test.mods)
+		if kp != test.exp {
+			t.Errorf("Test %d: Expected %#x to be %+v, but got %+v", i, test.mods, test.exp, kp)
+		}
+	}
+}
+
+func TestParseModifierMap(t *testing.T) {
+	def := defaultModifierMap("linux")
+	tests := []struct {
+		setting interface{}
+		exp     modifierMap
+	}{
+		{nil, def},
+		{"ctrl", def},
+		{map[string]interface{}{}, def},
+		{
+			map[string]interface{}{"ctrl": "super", "meta": "ctrl"},
+			modifierMap{"ctrl": "super", "alt": "alt", "meta": "ctrl", "altgr": ""},
+		},
+		{
+			map[string]interface{}{"alt": "none", "altgr": "alt"},
+			modifierMap{"ctrl": "ctrl", "alt": "", "meta": "super", "altgr": "alt"},
+		},
+		// unknown modifiers on either side are ignored
+		{
+			map[string]interface{}{"hyper": "ctrl", "ctrl": "hyper", "alt": 1.0},
+			def,
+		},
+	}
+
+	for i, test := range tests {
+		m := parseModifierMap(test.setting, def)
+		if len(m) != len(test.exp) {
+			t.Errorf("Test %d: Expected %v, but got %v", i, test.exp, m)
+			continue
+		}
+		for k, v := range test.exp {
+			if m[k] != v {
+				t.Errorf("Test %d: Expected %q to map to %q, but got %q", i, k, v, m[k])
+			}
+		}
+	}
+	if def["ctrl"] != "ctrl" {
+		t.Error("Expected the default map not to be modified")
+	}
+}
+
+func TestKeyPressModifierMap(t *testing.T) {
+	darwin := defaultModifierMap("darwin")
+	kp, ok := keyPress("", 0x43, ctrl_mod, darwin)
+	if !ok || kp.Key != 'c' || !kp.Super || kp.Ctrl {
+		t.Errorf("Expected ctrl+c to be super+c on darwin, but got %+v", kp)
+	}
+	// the windows AltGr combination still types its character
+	kp, ok = keyPress("@", 0x51, ctrl_mod|alt_mod, darwin)
+	if !ok || kp.Key != '@' || kp.Super || kp.Ctrl || kp.Alt {
+		t.Errorf("Expected AltGr+q to type '@', but got %+v", kp)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/limetext/qml-go"
+)
+
+type (
+	// overlaySource provides the items of an overlay and acts on the
+	// picked one
+	overlaySource interface {
+		items() []*overlayItem
+		selected(item *overlayItem)
+	}
+
+	// overlayHighlighter is implemented by sources that want to know which
+	// item is highlighted, e.g. to preview it
+	overlayHighlighter interface {
+		highlighted(item *overlayItem)
+	}
+
+	// overlayCanceller is implemented by sources that want to know when the
+	// overlay was closed without picking an item
+	overlayCanceller interface {
+		cancelled()
+	}
+
+	// overlayCompleter is implemented by sources completing the query on
+	// tab, item is the highlighted item or nil
+	overlayCompleter interface {
+		complete(query string, item *overlayItem) string
+	}
+
+	// overlayFilter is implemented by sources that filter the items
+	// themselves instead of fuzzy matching the query against the captions
+	overlayFilter interface {
+		filter(query string) []*overlayItem
+	}
+
+	overlayItem struct {
+		Caption string
+		Detail  string
+		Enabled bool
+		// Markup is the caption with the characters matching the query in
+		// bold
+		Markup string
+
+		score int
+		value interface{} // whatever the source needs to act on the item
+	}
+
+	// A helper glue structure holding the state of a window's overlay, like
+	// the command palette
+	overlay struct {
+		Visible     bool
+		Placeholder string
+		Text        string
+		Items       *overlayList
+
+		// guards source, all and query. Filtering happens with it held, as
+		// it's done from QML, commands and sources refreshing themselves.
+		lock   sync.Mutex
+		source overlaySource
+		all    []*overlayItem
+		query  string
+	}
+)
+
+func newOverlay(engine *qml.Engine) *overlay {
+	return &overlay{Items: newOverlayList(engine)}
+}
+
+// show opens the overlay with the items of src, text is the initial query.
+// The source shown before is cancelled.
+func (o *overlay) show(src overlaySource, placeholder, text string) {
+	if cur := o.currentSource(); cur != src {
+		if c, ok := cur.(overlayCanceller); ok {
+			c.cancelled()
+		}
+	}
+	all := src.items()
+	o.lock.Lock()
+	o.source = src
+	o.all = all
+	o.lock.Unlock()
+	o.Placeholder = placeholder
+	o.Text = text
+	o.Visible = true
+	o.Filter(text)
+	fe.qmlChanged(o, &o.Placeholder)
+	fe.qmlChanged(o, &o.Text)
+	fe.qmlChanged(o, &o.Visible)
+}
+
+func (o *overlay) hide() {
+	o.lock.Lock()
+	o.source = nil
+	o.all = nil
+	o.lock.Unlock()
+	o.Visible = false
+	o.Items.set(nil)
+	fe.qmlChanged(o, &o.Visible)
+}
+
+// Filter is called from QML when the query changes
+func (o *overlay) Filter(query string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.source == nil {
+		return
+	}
+	o.query = query
+	if f, ok := o.source.(overlayFilter); ok {
+		o.Items.set(f.filter(query))
+		return
+	}
+	o.Items.set(fuzzyFilter(o.all, query, func(it *overlayItem) string { return it.Caption }))
+}
+
+// refresh filters the items again on the main loop, where QML filters too,
+// for sources whose items change while the overlay is shown
+func (o *overlay) refresh() {
+	qml.RunMain(func() {
+		o.lock.Lock()
+		query := o.query
+		o.lock.Unlock()
+		o.Filter(query)
+	})
+}
+
+// currentSource returns the source of the items shown or nil
+func (o *overlay) currentSource() overlaySource {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.source
+}
+
+// fuzzyFilter returns the items whose key fuzzy matches query, best matches
+// first and disabled items last, with their Markup set accordingly
+func fuzzyFilter(items []*overlayItem, query string, key func(*overlayItem) string) []*overlayItem {
+	ret := make([]*overlayItem, 0, len(items))
+	for _, it := range items {
+		score, matched, ok := fuzzyMatch(query, key(it))
+		if !ok {
+			continue
+		}
+		it.score = score
+		it.Markup = fuzzyMarkup(it.Caption, matched)
+		ret = append(ret, it)
+	}
+	sort.Stable(byScore(ret))
+	return ret
+}
+
+type byScore []*overlayItem
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].Enabled != s[j].Enabled {
+		return s[i].Enabled
+	}
+	return s[i].score > s[j].score
+}
+
+// Select is called from QML when the item at index i is picked
+func (o *overlay) Select(i int) {
+	it := o.Items.item(i)
+	src := o.currentSource()
+	if it == nil || !it.Enabled || src == nil {
+		return
+	}
+	o.hide()
+	src.selected(it)
+}
+
+// Highlight is called from QML when the item at index i is highlighted
+func (o *overlay) Highlight(i int) {
+	it := o.Items.item(i)
+	if h, ok := o.currentSource().(overlayHighlighter); ok && it != nil {
+		h.highlighted(it)
+	}
+}
+
+// Cancel is called from QML when the overlay is closed without picking an
+// item
+func (o *overlay) Cancel() {
+	src := o.currentSource()
+	o.hide()
+	if c, ok := src.(overlayCanceller); ok {
+		c.cancelled()
+	}
+}
+
+// Complete is called from QML on tab with the index of the highlighted item,
+// it returns the completed query or an empty string
+func (o *overlay) Complete(i int) string {
+	o.lock.Lock()
+	src, query := o.source, o.query
+	o.lock.Unlock()
+	if c, ok := src.(overlayCompleter); ok {
+		return c.complete(query, o.Items.item(i))
+	}
+	return ""
+}
+
+// overlayList is the qml model of the items shown by an overlay
+type overlayList struct {
+	qml.ItemModel
+	qml.ItemModelDefaultImpl
+	items    []*overlayItem
+	internal qml.ItemModelInternal
+}
+
+var _ qml.ItemModelImpl = &overlayList{}
+
+func newOverlayList(engine *qml.Engine) *overlayList {
+	l := &overlayList{}
+	l.ItemModel, l.internal = qml.NewItemModel(engine, nil, l)
+	return l
+}
+
+func (l *overlayList) RowCount(parent qml.ModelIndex) int {
+	return len(l.items)
+}
+
+func (l *overlayList) Data(index qml.ModelIndex, role qml.Role) interface{} {
+	if index.IsValid() {
+		return l.items[index.Row()]
+	}
+	return nil
+}
+
+func (l *overlayList) Index(row int, column int, parent qml.ModelIndex) qml.ModelIndex {
+	if !parent.IsValid() && column == 0 && row >= 0 && row < len(l.items) {
+		return l.internal.CreateIndex(row, column, 0)
+	}
+	return nil
+}
+
+func (l *overlayList) item(i int) *overlayItem {
+	if i < 0 || i >= len(l.items) {
+		return nil
+	}
+	return l.items[i]
+}
+
+// set replaces all items of the list
+func (l *overlayList) set(items []*overlayItem) {
+	qml.RunMain(func() {
+		if n := len(l.items); n > 0 {
+			l.internal.BeginRemoveRows(nil, 0, n-1)
+			l.items = nil
+			l.internal.EndRemoveRows()
+		}
+		if n := len(items); n > 0 {
+			l.internal.BeginInsertRows(nil, 0, n-1)
+			l.items = items
+			l.internal.EndInsertRows()
+		}
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/limetext/backend/log"
+	"github.com/limetext/loaders"
+)
+
+// packageFiles returns the files at the top level of the packages whose name
+// matches pattern. Files of the Default package come first and the ones of
+// the User package last, which is the order they should be merged in.
+func packageFiles(pattern string) []string {
+	fis, err := ioutil.ReadDir(packagesPath)
+	if err != nil {
+		log.Warn("Couldn't read packages: %s", err)
+		return nil
+	}
+
+	pkgs := []string{filepath.Base(defaultPackagePath)}
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() && name != pkgs[0] && name != filepath.Base(userPackagePath) {
+			pkgs = append(pkgs, name)
+		}
+	}
+	pkgs = append(pkgs, filepath.Base(userPackagePath))
+
+	var files []string
+	for _, pkg := range pkgs {
+		matches, _ := filepath.Glob(filepath.Join(packagesPath, pkg, pattern))
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// syntaxFiles returns the syntax definitions of all packages
+func syntaxFiles() []string {
+	return packageFiles("*.tmLanguage")
+}
+
+// loadJSON decodes a sublime style json file, which may contain comments and
+// trailing commas, into v.
+func loadJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return loaders.LoadJSON(data, v)
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+)
+
+// paletteEntry is an entry of a .sublime-commands file
+type paletteEntry struct {
+	Caption string       `json:"caption"`
+	Command string       `json:"command"`
+	Args    backend.Args `json:"args"`
+}
+
+// commandPalette is the overlay source listing the entries of all
+// .sublime-commands files followed by the other registered commands
+type commandPalette struct {
+	w *window
+}
+
+func (p *commandPalette) items() []*overlayItem {
+	var items []*overlayItem
+	add := func(e *paletteEntry) {
+		if e.Args == nil {
+			e.Args = make(backend.Args)
+		}
+		items = append(items, &overlayItem{
+			Caption: e.Caption,
+			Detail:  e.Command,
+			Enabled: commandEnabled(e.Command, e.Args, nil, p.w.bw),
+			value:   e,
+		})
+	}
+
+	listed := make(map[string]bool)
+	for _, fn := range packageFiles("*.sublime-commands") {
+		var entries []*paletteEntry
+		if err := loadJSON(fn, &entries); err != nil {
+			log.Warn("Couldn't load %s: %s", fn, err)
+			continue
+		}
+		for _, e := range entries {
+			if e.Command == "" {
+				continue
+			}
+			if e.Caption == "" {
+				e.Caption = commandCaption(e.Command)
+			}
+			listed[e.Command] = true
+			add(e)
+		}
+	}
+	for _, name := range commandNames() {
+		if !listed[name] {
+			add(&paletteEntry{Caption: commandCaption(name), Command: name})
+		}
+	}
+	return items
+}
+
+func (p *commandPalette) selected(item *overlayItem) {
+	e := item.value.(*paletteEntry)
+	fe.RunCommandWithArgs(e.Command, e.Args)
+}
@@ -0,0 +1,275 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+)
+
+// the number of paths remembered by the path panel
+const pathHistoryLen = 50
+
+type (
+	// pathPanel is the overlay source of the simple file dialog, which is
+	// used instead of the qml FileDialog if use_simple_file_dialog is set.
+	// The query is a path, the items are the entries of its folder fuzzy
+	// matching its base name followed by the recent paths matching it.
+	pathPanel struct {
+		w          *window
+		history    *history
+		onlyFolder bool
+		save       bool
+		// the picked path or nil if cancelled
+		done chan []string
+	}
+
+	// pathEntry is the value of the items of the path panel
+	pathEntry struct {
+		path   string
+		dir    bool
+		create bool
+	}
+)
+
+// promptPath asks for a path with the path panel of w, it returns nil if the
+// panel was cancelled
+func (f *frontend) promptPath(w *window, opts promptOptions, folder string) []string {
+	if w.Overlay == nil {
+		return nil
+	}
+	p := &pathPanel{
+		w:          w,
+		history:    f.pathHistory,
+		onlyFolder: opts.flags&backend.PROMPT_ONLY_FOLDER != 0,
+		save:       opts.flags&backend.PROMPT_SAVE_AS != 0,
+		done:       make(chan []string, 1),
+	}
+	text := folder
+	if text != "" && !strings.HasSuffix(text, string(filepath.Separator)) {
+		text += string(filepath.Separator)
+	}
+	text += opts.name
+	w.Overlay.show(p, opts.title, text)
+
+	var files []string
+	select {
+	case files = <-p.done:
+	case <-time.After(dialogTimeout):
+		log.Warn("Timed out waiting for the path panel")
+		if w.Overlay.currentSource() == p {
+			w.Overlay.Cancel()
+		}
+	}
+	if len(files) > 0 {
+		p.history.add(files[0])
+	}
+	return files
+}
+
+func (p *pathPanel) items() []*overlayItem {
+	return nil
+}
+
+// filter lists the entries of the folder of query matching its base name
+func (p *pathPanel) filter(query string) []*overlayItem {
+	dir, base := splitPath(expandHome(query))
+	var items []*overlayItem
+	exists := false
+	if fis, err := ioutil.ReadDir(dir); err == nil {
+		for _, fi := range fis {
+			name := fi.Name()
+			if name == base {
+				exists = true
+			}
+			// hidden entries are only shown when asked for
+			if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+				continue
+			}
+			if p.onlyFolder && !fi.IsDir() {
+				continue
+			}
+			caption := name
+			if fi.IsDir() {
+				caption += string(filepath.Separator)
+			}
+			items = append(items, &overlayItem{
+				Caption: caption,
+				Enabled: true,
+				value:   &pathEntry{path: filepath.Join(dir, name), dir: fi.IsDir()},
+			})
+		}
+	}
+	items = fuzzyFilter(items, base, func(it *overlayItem) string { return it.Caption })
+
+	var recent []*overlayItem
+	for _, path := range p.history.list() {
+		if filepath.Dir(path) == filepath.Clean(dir) {
+			// already listed
+			continue
+		}
+		// paths that are gone aren't of much use
+		fi, err := os.Stat(path)
+		if err != nil || p.onlyFolder && !fi.IsDir() {
+			continue
+		}
+		caption := filepath.Base(path)
+		if fi.IsDir() {
+			caption += string(filepath.Separator)
+		}
+		recent = append(recent, &overlayItem{
+			Caption: caption,
+			Detail:  path,
+			Enabled: true,
+			value:   &pathEntry{path: path, dir: fi.IsDir()},
+		})
+	}
+	items = append(items, fuzzyFilter(recent, query, func(it *overlayItem) string { return it.Detail })...)
+
+	if base != "" && !exists {
+		caption := "Create " + filepath.Join(dir, base)
+		if p.save {
+			caption = "Save as " + filepath.Join(dir, base)
+		}
+		items = append(items, &overlayItem{
+			Caption: caption,
+			Markup:  caption,
+			Enabled: true,
+			value:   &pathEntry{path: filepath.Join(dir, base), dir: p.onlyFolder, create: true},
+		})
+	}
+	return items
+}
+
+// complete returns the query completed with the longest common prefix of
+// the entries matching it, or with item if that doesn't add anything
+func (p *pathPanel) complete(query string, item *overlayItem) string {
+	dir, base := splitPath(expandHome(query))
+	if fis, err := ioutil.ReadDir(dir); err == nil {
+		var names []string
+		isDir := false
+		for _, fi := range fis {
+			if strings.HasPrefix(fi.Name(), base) && (!p.onlyFolder || fi.IsDir()) {
+				names = append(names, fi.Name())
+				isDir = fi.IsDir()
+			}
+		}
+		if prefix := commonPrefix(names); len(prefix) > len(base) {
+			completed := filepath.Join(dir, prefix)
+			if len(names) == 1 && isDir {
+				completed += string(filepath.Separator)
+			}
+			return completed
+		}
+	}
+	if item == nil {
+		return ""
+	}
+	e := item.value.(*pathEntry)
+	switch {
+	case e.create:
+		return ""
+	case e.dir:
+		return e.path + string(filepath.Separator)
+	}
+	return e.path
+}
+
+// selected descends into folders, unless folders are asked for, and picks
+// anything else
+func (p *pathPanel) selected(item *overlayItem) {
+	e := item.value.(*pathEntry)
+	if e.dir && !p.onlyFolder {
+		p.w.Overlay.show(p, p.w.Overlay.Placeholder, e.path+string(filepath.Separator))
+		return
+	}
+	if e.create && !p.save {
+		if err := createPath(e.path, e.dir); err != nil {
+			log.Error("Couldn't create %s: %s", e.path, err)
+			p.done <- nil
+			return
+		}
+	}
+	p.done <- []string{e.path}
+}
+
+func (p *pathPanel) cancelled() {
+	p.done <- nil
+}
+
+// createPath creates the empty file or folder at path along with its parent
+// folders
+func createPath(path string, dir bool) error {
+	if dir {
+		return os.MkdirAll(path, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// splitPath splits path into its folder and the base name typed so far,
+// which is empty if path ends with a separator
+func splitPath(path string) (dir, base string) {
+	if path == "" {
+		if wd, err := os.Getwd(); err == nil {
+			return wd, ""
+		}
+		return ".", ""
+	}
+	dir, base = filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	return dir, base
+}
+
+// expandHome replaces a leading ~ with the home folder
+func expandHome(path string) string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	if home == "" || !strings.HasPrefix(path, "~") {
+		return path
+	}
+	if path == "~" {
+		return home + string(filepath.Separator)
+	}
+	if path[1] == '/' || path[1] == filepath.Separator {
+		return home + string(filepath.Separator) + path[2:]
+	}
+	return path
+}
+
+// commonPrefix returns the longest prefix all names share
+func commonPrefix(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	prefix := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	// don't cut runes in half
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
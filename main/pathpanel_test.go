@@ -0,0 +1,163 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		names []string
+		exp   string
+	}{
+		{nil, ""},
+		{[]string{"main.go"}, "main.go"},
+		{[]string{"main.go", "main_test.go", "mainview.qml"}, "main"},
+		{[]string{"a", "b"}, ""},
+		{[]string{"für", "fün"}, "fü"},
+		{[]string{"ü", "ö"}, ""},
+	}
+	for i, test := range tests {
+		if p := commonPrefix(test.names); p != test.exp {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.exp, p)
+		}
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home := os.Getenv("HOME")
+	if home == "" {
+		t.Skip("HOME isn't set")
+	}
+	sep := string(filepath.Separator)
+	tests := []struct {
+		path, exp string
+	}{
+		{"~", home + sep},
+		{"~/", home + sep},
+		{"~/src", home + sep + "src"},
+		{"~user", "~user"},
+		{"/tmp/~", "/tmp/~"},
+	}
+	for i, test := range tests {
+		if p := expandHome(test.path); p != test.exp {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.exp, p)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := newHistory(3)
+	for _, e := range []string{"a", "b", "", "a", "c", "d"} {
+		h.add(e)
+	}
+	if exp := []string{"d", "c", "a"}; !reflect.DeepEqual(h.list(), exp) {
+		t.Errorf("Expected %v, got %v", exp, h.list())
+	}
+
+	h.set([]string{"x", "y", "x", "z", "w"})
+	if exp := []string{"x", "y", "z"}; !reflect.DeepEqual(h.list(), exp) {
+		t.Errorf("Expected %v, got %v", exp, h.list())
+	}
+}
+
+// pathPanelDir creates the files and folders of the path panel tests in a
+// temporary folder and returns it
+func pathPanelDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pathpanel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"alpha/", "alpha.go", "alpine.txt", ".hidden", "beta/sub/deep/"} {
+		if err := createPath(filepath.Join(dir, filepath.FromSlash(p)), strings.HasSuffix(p, "/")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func captions(items []*overlayItem) []string {
+	ret := make([]string, len(items))
+	for i, it := range items {
+		ret[i] = filepath.ToSlash(it.Caption)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestPathPanelFilter(t *testing.T) {
+	dir := pathPanelDir(t)
+	defer os.RemoveAll(dir)
+	sep := string(filepath.Separator)
+	h := newHistory(pathHistoryLen)
+	h.set([]string{filepath.Join(dir, "beta", "sub", "deep"), filepath.Join(dir, "beta", "sub", "gone")})
+
+	tests := []struct {
+		query      string
+		onlyFolder bool
+		exp        []string
+	}{
+		// recent paths from other folders matching the query follow
+		{dir + sep, false, []string{"alpha.go", "alpha/", "alpine.txt", "beta/", "deep/"}},
+		{dir + sep + ".h", false, []string{".hidden", "Create " + filepath.ToSlash(dir) + "/.h"}},
+		{dir + sep + "alp", false, []string{"Create " + filepath.ToSlash(dir) + "/alp", "alpha.go", "alpha/", "alpine.txt"}},
+		{dir + sep + "alpha", false, []string{"alpha.go", "alpha/"}},
+		{dir + sep, true, []string{"alpha/", "beta/", "deep/"}},
+		// recent paths that are gone are left out
+		{filepath.Join(dir, "beta") + sep, false, []string{"deep/", "sub/"}},
+	}
+	for i, test := range tests {
+		p := &pathPanel{history: h, onlyFolder: test.onlyFolder}
+		if c := captions(p.filter(test.query)); !reflect.DeepEqual(c, test.exp) {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.exp, c)
+		}
+	}
+
+	p := &pathPanel{history: h}
+	for _, it := range p.filter(filepath.Join(dir, "beta") + sep) {
+		if e := it.value.(*pathEntry); !e.dir {
+			t.Errorf("Expected %s to be a folder", e.path)
+		}
+	}
+}
+
+func TestPathPanelComplete(t *testing.T) {
+	dir := pathPanelDir(t)
+	defer os.RemoveAll(dir)
+	sep := string(filepath.Separator)
+	alpha := &overlayItem{value: &pathEntry{path: filepath.Join(dir, "alpha"), dir: true}}
+	create := &overlayItem{value: &pathEntry{path: filepath.Join(dir, "alp"), create: true}}
+
+	tests := []struct {
+		query      string
+		item       *overlayItem
+		onlyFolder bool
+		exp        string
+	}{
+		// the longest common prefix of the matching entries
+		{dir + sep + "alph", nil, false, filepath.Join(dir, "alpha")},
+		{dir + sep + "alpi", nil, false, filepath.Join(dir, "alpine.txt")},
+		{dir + sep + "be", nil, false, filepath.Join(dir, "beta") + sep},
+		{dir + sep + "al", nil, true, filepath.Join(dir, "alpha") + sep},
+		// the highlighted item if that doesn't add anything
+		{dir + sep + "alp", nil, false, ""},
+		{dir + sep + "alp", alpha, false, filepath.Join(dir, "alpha") + sep},
+		{dir + sep + "alp", create, false, ""},
+		{dir + sep + "x", nil, false, ""},
+	}
+	for i, test := range tests {
+		p := &pathPanel{history: newHistory(pathHistoryLen), onlyFolder: test.onlyFolder}
+		if c := p.complete(test.query, test.item); c != test.exp {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.exp, c)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+	"github.com/limetext/qml-go"
+)
+
+const allFilesFilter = "All files (*)"
+
+// promptOptions are the options of promptFiles
+type promptOptions struct {
+	title string
+	// the folder shown first, defaults to the last folder of the window
+	// or the folder of the active view
+	folder string
+	// the suggested file name when saving
+	name string
+	// the name of the syntax whose files are shown first
+	filter string
+	// backend.PROMPT_* flags
+	flags int
+}
+
+// Prompt asks for files or a folder, depending on flags. When saving, the
+// name and syntax of the active view are suggested.
+func (f *frontend) Prompt(title, folder string, flags int) []string {
+	opts := promptOptions{title: title, folder: folder, flags: flags}
+	if flags&backend.PROMPT_SAVE_AS != 0 {
+		if bw := backend.GetEditor().ActiveWindow(); bw != nil {
+			if bv := bw.ActiveView(); bv != nil {
+				opts.suggest(bv)
+			}
+		}
+	}
+	return f.promptFiles(opts)
+}
+
+// suggest makes opts suggest the file name and syntax of bv when saving it
+func (opts *promptOptions) suggest(bv *backend.View) {
+	opts.name = suggestedName(bv)
+	opts.filter = syntaxName(bv.Settings().String("syntax", ""))
+}
+
+// promptFiles shows the file dialog of the active window with opts and
+// returns the files selected, or nil if it was cancelled
+func (f *frontend) promptFiles(opts promptOptions) []string {
+	w := f.window(backend.GetEditor().ActiveWindow())
+	if w == nil {
+		return nil
+	}
+	folder := opts.folder
+	if folder == "" {
+		folder = w.promptFolder()
+	}
+	if w.bw.Settings().Bool("use_simple_file_dialog", false) {
+		if !w.queueDialog() {
+			return nil
+		}
+		defer w.dialogDone()
+		files := f.promptPath(w, opts, folder)
+		if len(files) > 0 {
+			w.setPromptFolder(filepath.Dir(files[0]))
+		}
+		return files
+	}
+
+	onlyFolder := opts.flags&backend.PROMPT_ONLY_FOLDER != 0
+	save := opts.flags&backend.PROMPT_SAVE_AS != 0
+	// the dialog to use and its property holding the selected files
+	dialog, filesProp := "fileDialog", "fileUrls"
+	title := opts.title
+	if save && w.qw != nil && w.qw.Property("saveDialog") != nil {
+		dialog, filesProp = "saveDialog", "files"
+	} else if opts.name != "" {
+		// the FileDialog has no way of suggesting a file name
+		title = fmt.Sprintf("%s: %s", title, opts.name)
+	}
+
+	obj, res := f.runDialog(dialog, func(obj qml.Object) {
+		obj.Set("title", title)
+		if folder != "" {
+			obj.Set("folder", fileURL(folder))
+		}
+		if dialog == "saveDialog" {
+			if opts.name != "" {
+				obj.Set("currentFile", fileURL(filepath.Join(folder, opts.name)))
+			}
+		} else {
+			obj.Set("selectExisting", !save)
+			obj.Set("selectFolder", onlyFolder)
+			obj.Set("selectMultiple", opts.flags&backend.PROMPT_SELECT_MULTIPLE != 0)
+		}
+		if onlyFolder {
+			obj.Call("setNameFilters", "")
+			return
+		}
+		filters := syntaxFilters()
+		obj.Call("setNameFilters", strings.Join(filters, "\n"))
+		for _, filter := range filters {
+			if opts.filter != "" && strings.HasPrefix(filter, opts.filter+" (") {
+				obj.Call("selectNameFilter", filter)
+				break
+			}
+		}
+	})
+	if res != "accepted" {
+		return nil
+	}
+
+	urls := obj.List(filesProp)
+	var raw []string
+	urls.Convert(&raw)
+	files := make([]string, 0, len(raw))
+	for _, u := range raw {
+		if fn, err := urlPath(u); err != nil {
+			log.Warn("Ignoring selected file %s: %s", u, err)
+		} else {
+			files = append(files, fn)
+		}
+	}
+	if len(files) > 0 {
+		if onlyFolder {
+			w.setPromptFolder(files[0])
+		} else {
+			w.setPromptFolder(filepath.Dir(files[0]))
+		}
+	}
+	log.Fine("Selected %s files", files)
+	return files
+}
+
+// promptFolder returns the folder prompts of the window start in
+func (w *window) promptFolder() string {
+	w.folderLock.Lock()
+	dir := w.lastFolder
+	w.folderLock.Unlock()
+	if dir != "" {
+		return dir
+	}
+	if bv := w.bw.ActiveView(); bv != nil && bv.FileName() != "" {
+		return filepath.Dir(bv.FileName())
+	}
+	if wd, err := os.Getwd(); err == nil {
+		return wd
+	}
+	return ""
+}
+
+func (w *window) setPromptFolder(dir string) {
+	w.folderLock.Lock()
+	w.lastFolder = dir
+	w.folderLock.Unlock()
+}
+
+// fileURL returns the file url of path, with special characters escaped
+func fileURL(path string) string {
+	p := filepath.ToSlash(path)
+	// windows paths are like /C:/dir in urls, the drive isn't the host
+	if len(p) > 1 && p[1] == ':' {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// urlPath returns the path of the file url u
+func urlPath(u string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "file" {
+		return "", fmt.Errorf("not a file url")
+	}
+	p := parsed.Path
+	// windows paths are like /C:/dir
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p), nil
+}
+
+// nameFilter returns the qml name filter of the files with the given file
+// types, like "Python (*.py *.rpy)"
+func nameFilter(name string, types []string) string {
+	patterns := make([]string, len(types))
+	for i, t := range types {
+		patterns[i] = "*." + t
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(patterns, " "))
+}
+
+// syntaxFilters returns the name filters of all syntaxes sorted by name,
+// after one matching all files
+func syntaxFilters() []string {
+	ed := backend.GetEditor()
+	seen := make(map[string]bool)
+	var filters []string
+	for _, fn := range syntaxFiles() {
+		syntax := ed.GetSyntax(fn)
+		if syntax == nil || len(syntax.FileTypes()) == 0 || seen[syntax.Name()] {
+			continue
+		}
+		seen[syntax.Name()] = true
+		filters = append(filters, nameFilter(syntax.Name(), syntax.FileTypes()))
+	}
+	sort.Strings(filters)
+	return append([]string{allFilesFilter}, filters...)
+}
+
+// suggestedName returns the file name suggested when saving bv, its title
+// with the extension of its syntax
+func suggestedName(bv *backend.View) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, baseTitle(bv))
+	name = strings.TrimSuffix(name, "…")
+	if filepath.Ext(name) != "" {
+		return name
+	}
+	if syntax := backend.GetEditor().GetSyntax(bv.Settings().String("syntax", "")); syntax != nil {
+		if types := syntax.FileTypes(); len(types) > 0 {
+			name += "." + types[0]
+		}
+	}
+	return name
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileURL(t *testing.T) {
+	tests := []struct {
+		path, url string
+	}{
+		{"/tmp/a.go", "file:///tmp/a.go"},
+		{"/tmp/with space/100%.txt", "file:///tmp/with%20space/100%25.txt"},
+		{"/tmp/a#b?.txt", "file:///tmp/a%23b%3F.txt"},
+		{"C:/Users/a b.txt", "file:///C:/Users/a%20b.txt"},
+	}
+	for i, test := range tests {
+		path := filepath.FromSlash(test.path)
+		if u := fileURL(path); u != test.url {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.url, u)
+		}
+		if p, err := urlPath(test.url); err != nil || p != path {
+			t.Errorf("Test %d: Expected %s, got %s, %v", i, path, p, err)
+		}
+	}
+	if _, err := urlPath("http://example.com/a"); err == nil {
+		t.Error("Expected an error for a non file url")
+	}
+}
+
+func TestNameFilter(t *testing.T) {
+	if f := nameFilter("Python", []string{"py", "rpy"}); f != "Python (*.py *.rpy)" {
+		t.Errorf("Expected Python (*.py *.rpy), got %s", f)
+	}
+}
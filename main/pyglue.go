@@ -0,0 +1,98 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/limetext/gopy"
+)
+
+// callPlugin calls the function fn of sublime_plugin.py with args, which may
+// be strings and ints
+func callPlugin(fn string, args ...interface{}) error {
+	l := py.NewLock()
+	defer l.Unlock()
+
+	m, err := py.Import("sublime_plugin")
+	if err != nil {
+		return err
+	}
+	defer m.Decref()
+
+	objs := make([]py.Object, 0, len(args))
+	defer func() {
+		for _, o := range objs {
+			o.Decref()
+		}
+	}()
+	for _, a := range args {
+		switch a := a.(type) {
+		case string:
+			s, err := py.NewUnicode(a)
+			if err != nil {
+				return err
+			}
+			objs = append(objs, s)
+		case int:
+			objs = append(objs, py.NewLong(int64(a)))
+		default:
+			return fmt.Errorf("can't pass %T to python", a)
+		}
+	}
+
+	r, err := m.Base().CallMethodObjArgs(fn, objs...)
+	if r != nil {
+		r.Decref()
+	}
+	return err
+}
+
+// initLimeModule adds the lime python module, through which
+// sublime_plugin.py asks the frontend for what the backend doesn't provide,
+// like dialogs
+func initLimeModule() error {
+	l := py.NewLock()
+	defer l.Unlock()
+
+	_, err := py.InitModule("lime", []py.Method{
+		{Name: "yes_no_cancel_dialog", Func: pyYesNoCancelDialog},
+	})
+	return err
+}
+
+// pyStrings returns the items of the python tuple tu as strings, of which
+// there must be min to max
+func pyStrings(tu *py.Tuple, min, max int) ([]string, error) {
+	size := int(tu.Size())
+	if size < min || size > max {
+		return nil, fmt.Errorf("expected %d to %d arguments, got %d", min, max, size)
+	}
+	ret := make([]string, size)
+	for i := range ret {
+		o, err := tu.GetItem(int64(i))
+		if err != nil {
+			return nil, err
+		}
+		u, ok := o.(*py.Unicode)
+		if !ok {
+			return nil, fmt.Errorf("argument %d should be a string, not %s", i+1, o.Type())
+		}
+		ret[i] = u.String()
+	}
+	return ret, nil
+}
+
+// pyYesNoCancelDialog asks the message with a yes, no and cancel button and
+// returns one of sublime's DIALOG_YES, DIALOG_NO and DIALOG_CANCEL. The
+// captions of the yes and no buttons may follow the message.
+func pyYesNoCancelDialog(tu *py.Tuple, kw *py.Dict) (py.Object, error) {
+	args, err := pyStrings(tu, 1, 3)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, "", "")
+	return py.NewLong(int64(fe.YesNoCancelDialog(args[0], args[1], args[2]))), nil
+}
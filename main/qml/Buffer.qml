@@ -1,5 +1,7 @@
 import QtQuick 2.5
+import QtQuick.Controls 1.0
 import QtQuick.Layouts 1.0
+import "menus.js" as Menus
 
 Item {
     id: editorRoot
@@ -14,6 +16,8 @@ Item {
     property string fontFace: "Monospace"
     property var cursor: Qt.IBeamCursor
     property bool ctrl: false
+    // the .sublime-menu shown on right click
+    property string contextMenuName: "Context"
 
     onMyViewChanged: {
       if (myView != null) {
@@ -21,6 +25,58 @@ Item {
       }
     }
 
+    // flags for show, these mirror the ones in frontend.go
+    readonly property int showSurrounds: 1
+    readonly property int showAtCenter: 2
+    readonly property int keepToLeft: 4
+    readonly property int showAtTop: 8
+
+    // show scrolls the buffer so that the lines firstRow to lastRow are
+    // visible, horizontally scrolling to the given row and col.
+    function show(firstRow, lastRow, row, col, flags) {
+        var top = listView.contentY,
+            height = listView.height,
+            y1 = firstRow * lineHeight,
+            y2 = (lastRow + 1) * lineHeight,
+            margin = (flags & showSurrounds) ? lineHeight * 3 : 0,
+            maxY = Math.max(0, listView.count * lineHeight - height),
+            y = top;
+
+        if (flags & showAtTop) {
+            y = y1;
+        } else if (flags & showAtCenter) {
+            y = (y1 + y2 - height) / 2;
+        } else if (y1 - margin < top || y2 - y1 > height) {
+            y = y1 - margin;
+        } else if (y2 + margin > top + height) {
+            y = y2 + margin - height;
+        }
+        listView.contentY = Math.max(0, Math.min(y, maxY));
+
+        if (flags & keepToLeft) {
+            listView.contentX = 0;
+            return;
+        }
+        var x = getCursorOffset([row, col]),
+            width = listView.width - verticalScrollBar.width;
+        if (x < listView.contentX + gutterWidth) {
+            listView.contentX = Math.max(0, x - gutterWidth - spaceWidth * 4);
+        } else if (x > listView.contentX + width) {
+            listView.contentX = x - width + spaceWidth * 4;
+        }
+    }
+
+    // caretRect returns the rectangle of the first caret relative to the
+    // buffer, where input methods show their candidate window
+    function caretRect() {
+        var sel = getCurrentSelection();
+        if (!sel || sel.len() == 0) return Qt.rect(gutterWidth, 0, 1, lineHeight);
+        var rowcol = myView.back().rowCol(sel.get(0).b);
+        return Qt.rect(getCursorOffset(rowcol) - listView.contentX,
+                       rowcol[0] * lineHeight - listView.contentY,
+                       1, lineHeight);
+    }
+
     function getCurrentSelection() {
         if (!myView || !myView.back()) {
           console.log("returning null selection", myView, myView? myView.back() : false);
@@ -29,6 +85,10 @@ Item {
         return myView.back().sel();
     }
 
+    Menu {
+      id: contextMenu
+    }
+
     FontMetrics {
       id: fontMetrics
       font.family: editorRoot.fontFace
@@ -140,6 +200,13 @@ Item {
         property bool showBars: false
         property var cursor: editorRoot.cursor
 
+        function reportViewport() {
+            if (myView) myView.viewportChanged(contentY, height, lineHeight);
+        }
+        onContentYChanged: reportViewport()
+        onHeightChanged: reportViewport()
+        onCountChanged: reportViewport()
+
         delegate:
           Item {
             width: parent.width
@@ -150,6 +217,12 @@ Item {
             onLineTextChanged: {
               canvas.requestPaint();
             }
+            // the chunks can change without the text changing, e.g. when
+            // search matches are highlighted
+            property var lineVersion: !line ? 0 : line.version
+            onLineVersionChanged: {
+              canvas.requestPaint();
+            }
 
             Loader {
               id: gutter
@@ -202,6 +275,16 @@ Item {
                 for (var i = 0; i < len; i++) {
                   var c = l.chunk(i);
 
+                  if (c.match) {
+                    if (!c.measured) {
+                      measureChunk(c)
+                    }
+                    ctx.fillStyle = '#' + c.background;
+                    ctx.fillRect(x, 0, c.skipWidth + c.width, lineHeight);
+                    // make sure the text colour is set again below
+                    currentColor = null;
+                  }
+
                   if (c.foreground === "") {
                     if (currentColor !== defaultColor)
                       ctx.fillStyle = currentColor = defaultColor;
@@ -270,6 +353,7 @@ Item {
             y: 0
             cursorShape: parent.cursor
             propagateComposedEvents: true
+            acceptedButtons: Qt.LeftButton | Qt.RightButton
             height: parent.height
             width: parent.width-verticalScrollBar.width
 
@@ -364,6 +448,15 @@ Item {
             }
 
             onPressed: {
+                // clicking into another group's view makes it the active one
+                myView.setActive();
+                if (mouse.button == Qt.RightButton) {
+                    // the menu's commands get the position in the view's layout
+                    Menus.popupMenu(contextMenu, myView.contextMenu(contextMenuName,
+                        mouse.x + listView.contentX, mouse.y + listView.contentY));
+                    return;
+                }
+
                 // TODO:
                 // Changing caret position doesn't work on empty lines
 
@@ -390,6 +483,9 @@ Item {
                 var item  = listView.itemAt(0, mouse.y+listView.contentY),
                     index = listView.indexAt(0, mouse.y+listView.contentY);
 
+                // lines of find results open the location they show
+                if (item != null && myView.activateLine(index)) return;
+
                 if (item != null) {
                     var col = colFromMouseX(item.line, mouse.x);
                     point.p = myView.back().textPoint(index, col)
@@ -463,6 +559,7 @@ Item {
     Flickable  {
       anchors.fill: parent
       contentY: listView.contentY
+      contentX: listView.contentX
       interactive: false
 
       Repeater {
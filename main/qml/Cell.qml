@@ -4,6 +4,7 @@ import QtQuick.Controls.Styles 1.0
 import QtQuick.Dialogs 1.0
 import QtQuick.Layouts 1.0
 import QtGraphicalEffects 1.0
+import "menus.js" as Menus
 
 
 TabView {
@@ -11,6 +12,10 @@ TabView {
   Layout.fillWidth: true
   id: tabs
 
+  // the size of the tabs, to find where dragged tabs are dropped
+  property int tabWidth: 180 - 5
+  property int tabBarHeight: 28
+
   style: TabViewStyle {
       frameOverlap: 0
       tab: Item {
@@ -34,17 +39,65 @@ TabView {
               Text {
                   id: tab_title
                   anchors.centerIn: parent
-                  text: titleText.replace(/^.*[\\\/]/, '')
+                  text: titleText
+                  width: parent.width - 20
+                  horizontalAlignment: Text.AlignHCenter
+                  elide: Text.ElideRight
                   color: frontend.defaultFg()
                   anchors.verticalCenterOffset: 1
               }
           }
+          Menu {
+              id: tabMenu
+          }
+          MouseArea {
+              anchors.fill: parent
+              acceptedButtons: Qt.LeftButton | Qt.RightButton
+              cursorShape: dragging ? Qt.ClosedHandCursor : Qt.ArrowCursor
+
+              property point pressPos
+              property bool dragging: false
+
+              function tabView() {
+                  var tab = tabs.getTab(styleData.index),
+                      view = tab && tab.item && tab.item.children[0];
+                  return view && view.myView;
+              }
+
+              onPressed: {
+                  if (mouse.button != Qt.LeftButton) return;
+                  tabs.currentIndex = styleData.index;
+                  pressPos = Qt.point(mouse.x, mouse.y);
+                  dragging = false;
+              }
+              onPositionChanged: {
+                  if (!(mouse.buttons & Qt.LeftButton)) return;
+                  if (Math.abs(mouse.x - pressPos.x) > 10 || Math.abs(mouse.y - pressPos.y) > 10)
+                      dragging = true;
+              }
+              onReleased: {
+                  if (!dragging) return;
+                  dragging = false;
+                  // the frontend finds the group, or window, it was dropped on
+                  var p = mapToItem(null, mouse.x, mouse.y),
+                      view = tabView();
+                  if (view) view.dropTab(p.x, p.y);
+              }
+              onClicked: {
+                  if (mouse.button != Qt.RightButton) return;
+                  var view = tabView(),
+                      p = mapToItem(null, mouse.x, mouse.y);
+                  if (view)
+                      Menus.popupMenu(tabMenu, view.contextMenu("Tab Context", p.x, p.y));
+              }
+          }
       }
       tabBar: Image {
           fillMode: Image.TileHorizontally
           source: themeFolder + "/tabset-background.png"
       }
-      tabsMovable: true
+      // tabs are moved by dragging them, see the MouseArea above
+      tabsMovable: false
       frame: Rectangle { color: frontend.defaultBg() }
       tabOverlap: 5
   }
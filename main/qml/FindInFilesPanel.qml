@@ -0,0 +1,104 @@
+import QtQuick 2.0
+import QtQuick.Controls 1.0
+import QtQuick.Layouts 1.0
+
+Rectangle {
+    id: panel
+
+    property var model
+
+    visible: model ? model.visible : false
+    height: visible ? column.height + 12 : 0
+    color: frontend.defaultBg()
+    border.color: "#555555"
+
+    onVisibleChanged: {
+        if (visible) {
+            findField.text = model.pattern;
+            whereField.text = model.where;
+            findField.selectAll();
+            findField.forceActiveFocus();
+        }
+    }
+
+    function find() {
+        model.find(findField.text, whereField.text);
+    }
+
+    ColumnLayout {
+        id: column
+        anchors {
+            left: parent.left
+            right: parent.right
+            top: parent.top
+            margins: 6
+        }
+
+        RowLayout {
+            Layout.fillWidth: true
+
+            Button {
+                text: ".*"
+                tooltip: qsTr("Regular expression")
+                checkable: true
+                checked: panel.model ? panel.model.regex : false
+                onClicked: panel.model.setOption("regex", checked)
+            }
+            Button {
+                text: "Aa"
+                tooltip: qsTr("Case sensitive")
+                checkable: true
+                checked: panel.model ? panel.model.caseSensitive : false
+                onClicked: panel.model.setOption("case_sensitive", checked)
+            }
+            Button {
+                text: "\"\""
+                tooltip: qsTr("Whole word")
+                checkable: true
+                checked: panel.model ? panel.model.wholeWord : false
+                onClicked: panel.model.setOption("whole_word", checked)
+            }
+
+            TextField {
+                id: findField
+                Layout.fillWidth: true
+                placeholderText: qsTr("Find")
+                Keys.onReturnPressed: panel.find()
+                Keys.onEnterPressed: panel.find()
+                Keys.onEscapePressed: panel.model.hide()
+            }
+
+            Label {
+                text: panel.model ? panel.model.status : ""
+                color: frontend.defaultFg()
+            }
+
+            Button {
+                text: qsTr("Find")
+                onClicked: panel.find()
+            }
+            Button {
+                text: qsTr("Cancel")
+                visible: panel.model ? panel.model.searching : false
+                onClicked: panel.model.cancel()
+            }
+        }
+
+        RowLayout {
+            Layout.fillWidth: true
+
+            Label {
+                text: qsTr("Where:")
+                color: frontend.defaultFg()
+            }
+            TextField {
+                id: whereField
+                Layout.fillWidth: true
+                placeholderText: qsTr("<project>, *.go, -*_test.go")
+                Keys.onReturnPressed: panel.find()
+                Keys.onEnterPressed: panel.find()
+                Keys.onEscapePressed: panel.model.hide()
+            }
+        }
+    }
+}
@@ -0,0 +1,144 @@
+import QtQuick 2.0
+import QtQuick.Controls 1.0
+import QtQuick.Layouts 1.0
+
+Rectangle {
+    id: panel
+
+    property var model
+
+    visible: model ? model.visible : false
+    height: visible ? column.height + 12 : 0
+    color: frontend.defaultBg()
+    border.color: "#555555"
+
+    onVisibleChanged: {
+        if (visible) {
+            findField.text = model.pattern;
+            findField.selectAll();
+            findField.forceActiveFocus();
+        }
+    }
+
+    Connections {
+        target: panel.model
+        // the pattern is prefilled with the selection when the panel is
+        // shown again
+        onPatternChanged: {
+            if (panel.visible && findField.text != panel.model.pattern) {
+                findField.text = panel.model.pattern;
+                findField.selectAll();
+            }
+        }
+    }
+
+    function findNext(event) {
+        if (event.modifiers & Qt.ShiftModifier) model.findPrev();
+        else model.findNext();
+    }
+
+    ColumnLayout {
+        id: column
+        anchors {
+            left: parent.left
+            right: parent.right
+            top: parent.top
+            margins: 6
+        }
+
+        RowLayout {
+            Layout.fillWidth: true
+
+            Button {
+                text: ".*"
+                tooltip: qsTr("Regular expression")
+                checkable: true
+                checked: panel.model ? panel.model.regex : false
+                onClicked: panel.model.setOption("regex", checked)
+            }
+            Button {
+                text: "Aa"
+                tooltip: qsTr("Case sensitive")
+                checkable: true
+                checked: panel.model ? panel.model.caseSensitive : false
+                onClicked: panel.model.setOption("case_sensitive", checked)
+            }
+            Button {
+                text: "\"\""
+                tooltip: qsTr("Whole word")
+                checkable: true
+                checked: panel.model ? panel.model.wholeWord : false
+                onClicked: panel.model.setOption("whole_word", checked)
+            }
+            Button {
+                text: qsTr("In sel")
+                tooltip: qsTr("In selection")
+                checkable: true
+                checked: panel.model ? panel.model.inSelection : false
+                onClicked: panel.model.setOption("in_selection", checked)
+            }
+            Button {
+                text: qsTr("Wrap")
+                tooltip: qsTr("Wrap around")
+                checkable: true
+                checked: panel.model ? panel.model.wrap : true
+                onClicked: panel.model.setOption("wrap", checked)
+            }
+
+            TextField {
+                id: findField
+                Layout.fillWidth: true
+                placeholderText: qsTr("Find")
+                onTextChanged: {
+                    if (panel.model && panel.visible) panel.model.setPattern(text);
+                }
+                Keys.onReturnPressed: panel.findNext(event)
+                Keys.onEnterPressed: panel.findNext(event)
+                Keys.onEscapePressed: panel.model.hide()
+            }
+
+            Label {
+                text: panel.model ? panel.model.status : ""
+                color: frontend.defaultFg()
+            }
+
+            Button {
+                text: qsTr("Find")
+                onClicked: panel.model.findNext()
+            }
+            Button {
+                text: qsTr("Find Prev")
+                onClicked: panel.model.findPrev()
+            }
+            Button {
+                text: qsTr("Find All")
+                onClicked: panel.model.findAll()
+            }
+        }
+
+        RowLayout {
+            Layout.fillWidth: true
+            visible: panel.model ? panel.model.replaceVisible : false
+
+            TextField {
+                id: replaceField
+                Layout.fillWidth: true
+                placeholderText: qsTr("Replace")
+                onTextChanged: {
+                    if (panel.model) panel.model.setReplacement(text);
+                }
+                Keys.onReturnPressed: panel.model.replace()
+                Keys.onEnterPressed: panel.model.replace()
+                Keys.onEscapePressed: panel.model.hide()
+            }
+            Button {
+                text: qsTr("Replace")
+                onClicked: panel.model.replace()
+            }
+            Button {
+                text: qsTr("Replace All")
+                onClicked: panel.model.replaceAll()
+            }
+        }
+    }
+}
@@ -10,11 +10,13 @@ Item {
   Layout.fillHeight: true
   Layout.fillWidth: true
 
-  property var rows: [0, 0.7, 1]
-  property var cols: [0.0, 0.25, 0.75, 1.0]
-  property var cells: [[0, 0, 2, 3]] //[[0, 0, 1, 2], [1, 0, 2, 1], [0, 2, 1, 3], [1, 1, 2, 3]]
+  // the layout in the format of set_layout, it's set by the frontend
+  property var rows: [0, 1]
+  property var cols: [0, 1]
+  property var cells: [[0, 0, 1, 1]]
 
   property var tabsMap: ({})
+  property bool minimapVisible: true
 
   Component {
       id: tabTemplate
@@ -26,28 +28,57 @@ Item {
     View {
       id: tabView
       anchors.fill: parent
+      minimapVisible: mainView.minimapVisible
     }
   }
 
-  property alias cellCount: cellHolder.count
-  onCellCountChanged: {
-    // TODO: Actually track current cell!
-    currentCell = cellHolder.itemAt(0);
-  }
-
   property Cell currentCell: cellHolder.itemAt(0)
   property Tab currentTab: currentCell && currentCell.currentTab
   property View currentView: currentCell && currentCell.currentView
 
+  function setLayout(json) {
+    var l = JSON.parse(json);
+    rows = l.rows;
+    cols = l.cols;
+    cells = l.cells;
+    // cells are only added or removed at the end so that the tabs of the
+    // remaining ones stay where they are
+    while (cellModel.count > cells.length)
+      cellModel.remove(cellModel.count - 1);
+    while (cellModel.count < cells.length)
+      cellModel.append({group: cellModel.count});
+  }
+
+  function focusGroup(group) {
+    var cell = cellHolder.itemAt(group);
+    if (!cell) return;
+    currentCell = cell;
+    if (cell.currentMyView) cell.updateCurrent();
+  }
+
+  // tabCell returns the cell holding tab and its index in the cell
+  function tabCell(tab) {
+    var tabView = tab.parent.parent.parent;
+    for (var i = 0; i < tabView.count; i++) {
+      if (tabView.getTab(i) == tab) return {cell: tabView, index: i};
+    }
+    return {cell: tabView, index: -1};
+  }
+
   function getViewFromTab(tab) {
     return tab? tab.item.view : undefined;
   }
 
-  function addTab(tabId, view) {
-    var cell = currentCell;
+  // tabTitle returns the title of the tab of view, with a marker for
+  // unsaved changes
+  function tabTitle(view) {
+    return (view.title ? view.title : "untitled") + (view.dirty ? " \u25cf" : "");
+  }
+
+  function addTab(tabId, view, group) {
+    var cell = cellHolder.itemAt(group) || currentCell;
     var tab = cell.addTab(Qt.binding(function() {
-      console.log("view.title", view.title);
-      return view.title? view.title : "untitled";
+      return tabTitle(view);
     }), tabTemplate);
 
     tabsMap[tabId] = tab;
@@ -58,48 +89,84 @@ Item {
   }
 
   function activateTab(tabId) {
-    var tab = tabsMap[tabId];
-    var tabView = tab.parent.parent.parent;
-
-    for (var i = 0; i < tabView.count; i++) {
-      if (tabView.getTab(i) == tab) {
-        tabView.currentIndex = i;
-        return;
-      }
-    }
+    var tab = tabsMap[tabId],
+        t = tabCell(tab);
+    currentCell = t.cell;
+    t.cell.currentIndex = t.index;
   }
 
   function removeTab(tabId) {
-    var tab = tabsMap[tabId];
-    var tabView = tab.parent.parent.parent;
+    var tab = tabsMap[tabId],
+        t = tabCell(tab);
+    delete tabsMap[tabId];
+    if (t.index >= 0) t.cell.removeTab(t.index);
+  }
 
-    for (var i = 0; i < tabView.count; i++) {
-      if (tabView.getTab(i) == tab) {
-        tabView.removeTab(i);
-        return;
-      }
+  // moveTab moves a tab to index in the cell of group, or to its end if
+  // index is out of range. The view is moved along instead of being created
+  // again.
+  function moveTab(tabId, group, index) {
+    var tab = tabsMap[tabId],
+        cell = cellHolder.itemAt(group);
+    if (!tab || !cell) return;
+    var t = tabCell(tab);
+    if (t.cell == cell) {
+      if (index < 0 || index >= cell.count) index = cell.count - 1;
+      cell.moveTab(t.index, index);
+      return;
     }
+
+    if (index < 0 || index > cell.count) index = cell.count;
+    var view = tab.item.children[0],
+        moved = cell.insertTab(index, tab.title, tabTemplate);
+    moved.title = Qt.binding(function() {
+      return tabTitle(view.myView);
+    });
+    moved.active = true;
+    view.parent = moved.item;
+    tabsMap[tabId] = moved;
+    t.cell.removeTab(t.index);
+  }
+
+  // groupAt returns the group of the cell at x, y in window coordinates or
+  // -1 if there is none
+  function groupAt(x, y) {
+    for (var i = 0; i < cellHolder.count; i++) {
+      var cell = cellHolder.itemAt(i),
+          p = cell.mapFromItem(null, x, y);
+      if (cell.contains(p)) return i;
+    }
+    return -1;
   }
 
-  function setTabTitle(tabId, title) {
-    var tab = tabsMap[tabId];
-    tab.title = title;
+  // tabIndexAt returns the index a tab dropped at x, y in window
+  // coordinates onto the tab bar of group gets, or -1 for the end
+  function tabIndexAt(group, x, y) {
+    var cell = cellHolder.itemAt(group);
+    if (!cell) return -1;
+    var p = cell.mapFromItem(null, x, y);
+    if (p.y > cell.tabBarHeight) return -1;
+    return Math.min(Math.floor(p.x / cell.tabWidth), cell.count);
+  }
+
+  ListModel {
+    id: cellModel
+    ListElement { group: 0 }
   }
 
   Repeater {
     id: cellHolder
 
-    model: cells
+    model: cellModel
 
     Cell {
       id: cellItem
 
-      // property Cell cell: cellCell
-
-      property real leftPercent: rows[modelData[0]]
-      property real topPercent: cols[modelData[1]]
-      property real rightPercent: rows[modelData[2]]
-      property real bottomPercent: cols[modelData[3]]
+      property var cell: cells[index] || [0, 0, 1, 1]
+      property real leftPercent: cols[cell[0]]
+      property real topPercent: rows[cell[1]]
+      property real rightPercent: cols[cell[2]]
+      property real bottomPercent: rows[cell[3]]
 
       property real leftT: mainView.width * leftPercent
       property real topT: mainView.height * topPercent
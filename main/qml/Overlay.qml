@@ -0,0 +1,114 @@
+import QtQuick 2.0
+import QtQuick.Controls 1.0
+
+Rectangle {
+    id: overlay
+
+    property var model
+    property int maxListHeight: 400
+
+    visible: model ? model.visible : false
+    width: 500
+    height: input.height + list.height + 18
+    color: frontend.defaultBg()
+    border.color: "#555555"
+
+    onVisibleChanged: {
+        if (visible) {
+            input.text = model.text;
+            input.selectAll();
+            input.forceActiveFocus();
+            list.currentIndex = 0;
+        }
+    }
+
+    function select() {
+        if (model) model.select(list.currentIndex);
+    }
+
+    TextField {
+        id: input
+        anchors {
+            left: parent.left
+            right: parent.right
+            top: parent.top
+            margins: 6
+        }
+        placeholderText: overlay.model ? overlay.model.placeholder : ""
+        onTextChanged: {
+            if (!overlay.model || !overlay.visible) return;
+            overlay.model.filter(text);
+            list.currentIndex = 0;
+        }
+        Keys.onUpPressed: list.decrementCurrentIndex()
+        Keys.onDownPressed: list.incrementCurrentIndex()
+        Keys.onReturnPressed: overlay.select()
+        Keys.onEnterPressed: overlay.select()
+        Keys.onEscapePressed: overlay.model.cancel()
+        Keys.onTabPressed: {
+            var t = overlay.model.complete(list.currentIndex);
+            if (t) text = t;
+        }
+    }
+
+    // the source may show the overlay again with another query while it's
+    // visible, like the path panel entering a folder
+    Connections {
+        target: overlay.model
+        onTextChanged: {
+            if (overlay.visible && input.text != overlay.model.text) input.text = overlay.model.text;
+        }
+    }
+
+    ListView {
+        id: list
+        anchors {
+            left: parent.left
+            right: parent.right
+            top: input.bottom
+            margins: 6
+        }
+        height: Math.min(contentHeight, overlay.maxListHeight)
+        clip: true
+        model: overlay.model ? overlay.model.items : null
+        highlightMoveDuration: 0
+
+        onCurrentIndexChanged: {
+            if (overlay.model && overlay.visible) overlay.model.highlight(currentIndex);
+        }
+
+        delegate: Rectangle {
+            property var item: display
+
+            width: list.width
+            height: column.height + 6
+            color: ListView.isCurrentItem ? "#44ffffff" : "transparent"
+
+            Column {
+                id: column
+                x: 4
+                y: 3
+                Text {
+                    text: item ? item.markup : ""
+                    textFormat: Text.StyledText
+                    color: frontend.defaultFg()
+                    opacity: item && item.enabled ? 1 : 0.4
+                }
+                Text {
+                    text: item ? item.detail : ""
+                    visible: text != ""
+                    font.pointSize: 8
+                    color: "#888888"
+                }
+            }
+
+            MouseArea {
+                anchors.fill: parent
+                onClicked: {
+                    list.currentIndex = index;
+                    overlay.select();
+                }
+            }
+        }
+    }
+}
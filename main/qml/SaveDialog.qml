@@ -0,0 +1,29 @@
+import QtQuick 2.0
+import Qt.labs.platform 1.0
+
+// The save dialog of Qt.labs.platform, which can suggest a file name. It's
+// loaded by Window.qml, older Qt versions without it save with the FileDialog
+// instead.
+Item {
+    property alias dialog: saveDialog
+
+    FileDialog {
+        id: saveDialog
+        objectName: "saveDialog"
+        property int requestId
+        fileMode: FileDialog.SaveFile
+
+        // filters are passed joined by newlines
+        function setNameFilters(filters) {
+            nameFilters = filters ? filters.split("\n") : [];
+        }
+
+        function selectNameFilter(filter) {
+            var i = nameFilters.indexOf(filter);
+            if (i >= 0) selectedNameFilter.index = i;
+        }
+
+        onAccepted: frontend.promptClosed(requestId, "accepted")
+        onRejected: frontend.promptClosed(requestId, "rejected")
+    }
+}
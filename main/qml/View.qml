@@ -15,6 +15,7 @@ Item {
   property var cursor: Qt.IBeamCursor
   property bool ctrl: false
   property bool minimapVisible: true
+  property string contextMenuName: "Context"
   property var linesModel: myView.formattedLines
 
   function setTitle(title) {
@@ -46,11 +47,23 @@ Item {
       }
   }
 
+  onLinesModelChanged: {
+    if (myView && linesModel) myView.linesReady();
+  }
+
   function onSelectionModified() {
       if (myView == undefined) return;
       editorView.onSelectionModified();
   }
 
+  function show(firstRow, lastRow, row, col, flags) {
+      editorView.show(firstRow, lastRow, row, col, flags);
+  }
+
+  function caretRect() {
+      return editorView.caretRect();
+  }
+
   RowLayout {
     anchors.fill: parent
     Buffer {
@@ -65,6 +78,7 @@ Item {
         fontFace: viewRoot.fontFace
         cursor: viewRoot.cursor
         ctrl: viewRoot.ctrl
+        contextMenuName: viewRoot.contextMenuName
     }
     Minimap {
         id: minimap
@@ -4,6 +4,7 @@ import QtQuick.Controls.Styles 1.0
 import QtQuick.Dialogs 1.2
 import QtQuick.Layouts 1.0
 import QtGraphicalEffects 1.0
+import "menus.js" as Menus
 
 ApplicationWindow {
     id: window
@@ -14,8 +15,34 @@ ApplicationWindow {
     property var myWindow
     property string themeFolder: "../../packages/Soda/Soda Dark"
 
-    function addTab(tabId, view) {
-        return mainView.addTab(tabId, view);
+    onClosing: {
+        // the frontend destroys the window once unsaved changes are handled
+        close.accepted = false;
+        myWindow.requestClose();
+    }
+
+    function addTab(tabId, view, group) {
+        return mainView.addTab(tabId, view, group);
+    }
+
+    function moveTab(tabId, group, index) {
+        return mainView.moveTab(tabId, group, index);
+    }
+
+    function groupAt(x, y) {
+        return mainView.groupAt(x, y);
+    }
+
+    function tabIndexAt(group, x, y) {
+        return mainView.tabIndexAt(group, x, y);
+    }
+
+    function setLayout(json) {
+        return mainView.setLayout(json);
+    }
+
+    function focusGroup(group) {
+        return mainView.focusGroup(group);
     }
 
     function activateTab(tabId) {
@@ -26,157 +53,179 @@ ApplicationWindow {
         return mainView.removeTab(tabId);
     }
 
-    function setTabTitle(tabId, title) {
-        return mainView.setTabTitle(tabId, title);
-    }
-
     menuBar: MenuBar {
         id: menu
-        Menu {
-            title: qsTr("File")
-            MenuItem {
-                text: qsTr("New File")
-                onTriggered: frontend.runCommand("new_file");
-            }
-            MenuItem {
-                text: qsTr("Open File...")
-                onTriggered: frontend.runCommand("prompt_open_file");
-            }
-            MenuItem {
-                text: qsTr("Save")
-                onTriggered: frontend.runCommand("save");
-            }
-            MenuItem {
-                text: qsTr("Save As...")
-                onTriggered: frontend.runCommand("prompt_save_as");
-            }
-            MenuItem {
-                text: qsTr("Save All")
-                onTriggered: frontend.runCommand("save_all")
-            }
-            MenuSeparator{}
-            MenuItem {
-                text: qsTr("New Window")
-                onTriggered: frontend.runCommand("new_window");
-            }
-            MenuItem {
-                text: qsTr("Close Window")
-                onTriggered: frontend.runCommand("close_window");
-            }
-            MenuSeparator{}
-            MenuItem {
-                text: qsTr("Close File")
-                onTriggered: frontend.runCommand("close");
-            }
-            MenuItem {
-                text: qsTr("Close All Files")
-                onTriggered: frontend.runCommand("close_all");
-            }
-            MenuSeparator{}
-            MenuItem {
-                text: qsTr("Quit")
-                // TODO: frontend.runCommand("quit");
-                onTriggered: Qt.quit();
-            }
-        }
-        Menu {
-            title: qsTr("Find")
-            MenuItem {
-                text: qsTr("Find Next")
-                onTriggered: frontend.runCommand("find_next");
-            }
-        }
-        Menu {
-            title: qsTr("Edit")
-            MenuItem {
-                text: qsTr("Undo")
-                onTriggered: frontend.runCommand("undo");
-            }
-            MenuItem {
-                text: qsTr("Redo")
-                onTriggered: frontend.runCommand("redo");
-            }
-            Menu {
-                title: qsTr("Undo Selection")
-                MenuItem {
-                    text: qsTr("Soft Undo")
-                    onTriggered: frontend.runCommand("soft_undo");
-                }
-                MenuItem {
-                    text: qsTr("Soft Redo")
-                    onTriggered: frontend.runCommand("soft_redo");
-                }
-            }
-            MenuSeparator{}
-            MenuItem {
-                text: qsTr("Copy")
-                onTriggered: frontend.runCommand("copy");
-            }
-            MenuItem {
-                text: qsTr("Cut")
-                onTriggered: frontend.runCommand("cut");
-            }
-            MenuItem {
-                text: qsTr("Paste")
-                onTriggered: frontend.runCommand("paste");
-            }
-        }
-        Menu {
-            title: qsTr("View")
-            MenuItem {
-                text: qsTr("Show/Hide Console")
-                onTriggered: { consoleView.visible = !consoleView.visible }
-            }
-            MenuItem {
-                text: qsTr("Show/Hide Minimap")
-                onTriggered: {
-                    var tab = tabs.getTab(tabs.currentIndex);
+    }
 
-                    if (tab.item)
-                        tab.item.minimapVisible = !tab.item.minimapVisible;
-                }
-            }
-            MenuItem {
-                text: qsTr("Show/Hide Statusbar")
-                onTriggered: { statusBar.visible = !statusBar.visible }
-            }
-        }
+    Component {
+        id: menuComponent
+        Menu {}
+    }
+
+    // the menus are built from the Main.sublime-menu files of the packages
+    Component.onCompleted: {
+        Menus.buildMenuBar(menu, menuComponent, frontend.menu("Main"));
     }
 
     property Tab currentTab: mainView.currentTab
     property View currentView: mainView.currentView
 
     Item {
-        anchors.fill: parent
+        id: keyHandler
+        anchors {
+            top: parent.top
+            left: parent.left
+            right: parent.right
+            bottom: findPanel.top
+        }
         Keys.onPressed: {
             var v = currentView; if (v === undefined) return;
             if (event.key == Qt.Key_Control) v.ctrl = true;
             event.accepted = frontend.handleInput(event.text, event.key, event.modifiers)
             event.accepted = true;
+            // keep the candidate window of input methods at the caret
+            imeInput.reposition();
         }
         Keys.onReleased: {
             var v = currentView; if (v === undefined) return;
             if (event.key == Qt.Key_Control) v.ctrl = false;
         }
-        focus: true // Focus required for Keys.onPressed
+        // key presses go through the input method item so that input
+        // method events reach us too
+        onActiveFocusChanged: {
+            if (activeFocus) imeInput.forceActiveFocus();
+        }
         SplitView {
             anchors.fill: parent
             orientation: Qt.Vertical
             MainView {
                 id: mainView
+                objectName: "mainView"
+                minimapVisible: myWindow ? myWindow.minimapVisible : true
             }
-            View {
-                id: consoleView
-                myView: frontend.console
-                visible: false
-                minimapVisible: false
-                height: 100
+            ColumnLayout {
+                visible: myWindow ? myWindow.consoleVisible : false
+                height: 130
+                spacing: 0
+                View {
+                    id: consoleView
+                    myView: frontend.console
+                    minimapVisible: false
+                    contextMenuName: "Console Context"
+                    Layout.fillWidth: true
+                    Layout.fillHeight: true
+                }
+                // python entered here runs in the interpreter of the
+                // packages, up and down go through the inputs entered before
+                TextField {
+                    id: consoleInput
+                    Layout.fillWidth: true
+                    placeholderText: qsTr("Python")
+                    font.family: "Monospace"
+                    property int historyIndex: -1
+                    function run() {
+                        frontend.consoleEval(text);
+                        text = "";
+                        historyIndex = -1;
+                    }
+                    Keys.onReturnPressed: run()
+                    Keys.onEnterPressed: run()
+                    Keys.onUpPressed: {
+                        var entry = frontend.consoleHistory(historyIndex + 1);
+                        if (entry === "") return;
+                        historyIndex++;
+                        text = entry;
+                    }
+                    Keys.onDownPressed: {
+                        if (historyIndex < 0) return;
+                        historyIndex--;
+                        text = historyIndex < 0 ? "" : frontend.consoleHistory(historyIndex);
+                    }
+                    Keys.onEscapePressed: keyHandler.forceActiveFocus()
+                }
+            }
+        }
+
+        // imeInput takes the input method events for the current view. The
+        // preedit text is shown at the caret without touching the buffer,
+        // committed text is inserted through the frontend. Key presses are
+        // forwarded to the key handler so this never gets any other text.
+        Rectangle {
+            x: imeInput.x
+            y: imeInput.y
+            width: imeInput.contentWidth
+            height: imeInput.height
+            visible: imeInput.inputMethodComposing
+            color: frontend.defaultBg()
+        }
+        TextInput {
+            id: imeInput
+            focus: true // Focus required for Keys.onPressed
+            width: Math.max(contentWidth, 1)
+            color: frontend.defaultFg()
+            font.family: currentView ? currentView.fontFace : "Monospace"
+            font.pointSize: currentView ? currentView.fontSize : 10
+            cursorVisible: false
+            Keys.forwardTo: [keyHandler]
+
+            function reposition() {
+                if (!currentView) return;
+                var r = currentView.caretRect(),
+                    p = currentView.mapToItem(keyHandler, r.x, r.y);
+                x = p.x;
+                y = p.y;
+                height = r.height;
+            }
+
+            onInputMethodComposingChanged: reposition()
+            onTextChanged: {
+                if (text == "") return;
+                frontend.insertText(text);
+                text = "";
             }
         }
     }
 
+    FindPanel {
+        id: findPanel
+        model: myWindow ? myWindow.find : null
+        anchors {
+            left: parent.left
+            right: parent.right
+            bottom: findInFilesPanel.top
+        }
+        onVisibleChanged: {
+            if (!visible) keyHandler.forceActiveFocus();
+        }
+    }
+
+    FindInFilesPanel {
+        id: findInFilesPanel
+        model: myWindow ? myWindow.findInFiles : null
+        anchors {
+            left: parent.left
+            right: parent.right
+            bottom: parent.bottom
+        }
+        onVisibleChanged: {
+            if (!visible) keyHandler.forceActiveFocus();
+        }
+    }
+
+    Overlay {
+        id: overlay
+        model: myWindow ? myWindow.overlay : null
+        anchors.horizontalCenter: parent.horizontalCenter
+        y: 0
+        z: 1000
+        onVisibleChanged: {
+            if (!visible) keyHandler.forceActiveFocus();
+        }
+    }
+
     statusBar: StatusBar {
         id: statusBar
+        visible: myWindow ? myWindow.statusBarVisible : true
         property color textColor: "#969696"
         style: StatusBarStyle {
             background: Image {
@@ -187,15 +236,60 @@ ApplicationWindow {
                 right: 24
             }
         }
-        RowLayout {
-            anchors.verticalCenter: parent.verticalCenter
+        property var statusView: currentView && currentView.myView ? currentView.myView : null
+
+        Menu {
+            id: statusMenu
+        }
+
+        // StatusLabel shows a status item, clicking it runs its command or
+        // pops up its menu
+        Component {
+            id: statusLabel
             Label {
-                text: currentView && currentView.myView ? currentView.myView.status : ""
+                property var item
+                text: item ? item.text : ""
                 color: statusBar.textColor
+                MouseArea {
+                    anchors.fill: parent
+                    enabled: parent.item ? parent.item.isClickable() : false
+                    cursorShape: enabled ? Qt.PointingHandCursor : Qt.ArrowCursor
+                    onClicked: {
+                        var m = parent.item.click();
+                        if (m) Menus.popupMenu(statusMenu, m);
+                    }
+                }
             }
-            Label {
-                text: currentView && currentView.myView ? currentView.myView.selectionStatus : ""
-                color: statusBar.textColor
+        }
+
+        RowLayout {
+            anchors.verticalCenter: parent.verticalCenter
+            spacing: 18
+            Repeater {
+                model: statusBar.statusView ? statusBar.statusView.segmentsLen : 0
+                Loader {
+                    sourceComponent: statusLabel
+                    property var segment: {
+                        statusBar.statusView.statusVersion;
+                        return statusBar.statusView.segment(index);
+                    }
+                    visible: segment ? !segment.right : false
+                    onSegmentChanged: if (item) item.item = segment
+                    onLoaded: item.item = segment
+                }
+            }
+            // the set_status items of plugins, sorted by key
+            Repeater {
+                model: statusBar.statusView ? statusBar.statusView.statusLen : 0
+                Loader {
+                    sourceComponent: statusLabel
+                    property var statusItem: {
+                        statusBar.statusView.statusVersion;
+                        return statusBar.statusView.statusItem(index);
+                    }
+                    onStatusItemChanged: if (item) item.item = statusItem
+                    onLoaded: item.item = statusItem
+                }
             }
             Label {
                 text: myWindow ? myWindow.status : ""
@@ -206,32 +300,195 @@ ApplicationWindow {
             anchors.right: parent.right
             anchors.verticalCenter: parent.verticalCenter
             spacing: 42
-            Label {
-                color: statusBar.textColor
-                text: "Tab Size: "+(currentView && currentView.myView ? currentView.myView.tabSize : "")
+            Repeater {
+                model: statusBar.statusView ? statusBar.statusView.segmentsLen : 0
+                Loader {
+                    sourceComponent: statusLabel
+                    property var segment: {
+                        statusBar.statusView.statusVersion;
+                        return statusBar.statusView.segment(index);
+                    }
+                    visible: segment ? segment.right : false
+                    onSegmentChanged: if (item) item.item = segment
+                    onLoaded: item.item = segment
+                }
             }
-            Label {
-                color: statusBar.textColor
-                text: currentView && currentView.myView ? currentView.myView.syntaxName : ""
+        }
+    }
+
+    // toast notifications, clicking one dismisses it
+    Column {
+        anchors.right: parent.right
+        anchors.bottom: parent.bottom
+        anchors.margins: 12
+        spacing: 6
+        z: 10
+        Repeater {
+            model: myWindow ? myWindow.toastsLen : 0
+            Rectangle {
+                property var toast: {
+                    myWindow.toastsVersion;
+                    return myWindow.toast(index);
+                }
+                width: 320
+                height: toastText.implicitHeight + 16
+                radius: 4
+                opacity: 0.9
+                color: !toast ? "transparent" : toast.severity == "error" ? "#a33" : toast.severity == "warning" ? "#a73" : "#444"
+                Text {
+                    id: toastText
+                    anchors.fill: parent
+                    anchors.margins: 8
+                    text: toast ? toast.text : ""
+                    color: "white"
+                    wrapMode: Text.Wrap
+                }
+                MouseArea {
+                    anchors.fill: parent
+                    onClicked: myWindow.dismissToast(index)
+                }
             }
         }
     }
 
     MessageDialog {
         objectName: "messageDialog"
-        onAccepted: frontend.promptClosed("accepted")
-        onApply: frontend.promptClosed("apply")
-        onDiscard: frontend.promptClosed("discard")
-        onHelp: frontend.promptClosed("help")
-        onNo: frontend.promptClosed("no")
-        onRejected: frontend.promptClosed("rejected")
-        onReset: frontend.promptClosed("reset")
-        onYes: frontend.promptClosed("yes")
+        property int requestId
+        onAccepted: frontend.promptClosed(requestId, "accepted")
+        onApply: frontend.promptClosed(requestId, "apply")
+        onDiscard: frontend.promptClosed(requestId, "discard")
+        onHelp: frontend.promptClosed(requestId, "help")
+        onNo: frontend.promptClosed(requestId, "no")
+        onRejected: frontend.promptClosed(requestId, "rejected")
+        onReset: frontend.promptClosed(requestId, "reset")
+        onYes: frontend.promptClosed(requestId, "yes")
+    }
+
+    // questionDialog is a message dialog with custom button captions
+    Dialog {
+        id: questionDialog
+        objectName: "questionDialog"
+        title: qsTr("Question")
+        property int requestId
+        property string text
+        // [result, caption] pairs
+        property var buttons: []
+        property bool answered: false
+
+        function clear() {
+            buttons = [];
+            answered = false;
+        }
+
+        function addButton(result, caption) {
+            var b = buttons;
+            b.push([result, caption]);
+            buttons = b;
+        }
+
+        function answer(result) {
+            answered = true;
+            close();
+            frontend.promptClosed(requestId, result);
+        }
+
+        contentItem: Rectangle {
+            implicitWidth: questionColumn.implicitWidth + 24
+            implicitHeight: questionColumn.implicitHeight + 24
+            color: "#f0f0f0"
+            focus: true
+            Keys.onEscapePressed: questionDialog.answer("rejected")
+            ColumnLayout {
+                id: questionColumn
+                anchors.fill: parent
+                anchors.margins: 12
+                spacing: 12
+                Label {
+                    text: questionDialog.text
+                    wrapMode: Text.Wrap
+                    Layout.maximumWidth: 480
+                }
+                RowLayout {
+                    Layout.alignment: Qt.AlignRight
+                    Repeater {
+                        model: questionDialog.buttons
+                        Button {
+                            text: modelData[1]
+                            isDefault: index == 0
+                            onClicked: questionDialog.answer(modelData[0])
+                        }
+                    }
+                }
+            }
+        }
+
+        // closing the window of the dialog cancels it
+        onVisibleChanged: if (!visible && !answered) answer("rejected")
+    }
+
+    Dialog {
+        id: unsavedDialog
+        objectName: "unsavedDialog"
+        title: qsTr("Unsaved changes")
+        standardButtons: StandardButton.Save | StandardButton.Discard | StandardButton.Cancel
+
+        property int requestId
+        property var files: []
+
+        function clear() {
+            files = [];
+        }
+
+        function addFile(name) {
+            var f = files;
+            f.push(name);
+            files = f;
+        }
+
+        function isChecked(i) {
+            return unsavedFiles.itemAt(i).checked;
+        }
+
+        ColumnLayout {
+            Label {
+                text: qsTr("The following files have unsaved changes, save them?")
+            }
+            Repeater {
+                id: unsavedFiles
+                model: unsavedDialog.files
+                CheckBox {
+                    text: modelData
+                    checked: true
+                }
+            }
+        }
+
+        onAccepted: frontend.promptClosed(requestId, "accepted")
+        onDiscard: frontend.promptClosed(requestId, "discard")
+        onRejected: frontend.promptClosed(requestId, "rejected")
+    }
+
+    // The save dialog of Qt.labs.platform can suggest a file name, which the
+    // FileDialog below can't. Older Qt versions don't have it, saving uses
+    // the FileDialog then.
+    property var saveDialog: saveDialogLoader.item ? saveDialogLoader.item.dialog : null
+
+    Loader {
+        id: saveDialogLoader
+        source: "SaveDialog.qml"
+        onStatusChanged: if (status == Loader.Error) frontend.saveDialogFailed(source.toString())
     }
 
     FileDialog {
         objectName: "fileDialog"
-        onAccepted: frontend.promptClosed("accepted")
-        onRejected: frontend.promptClosed("rejected")
+        property int requestId
+
+        // filters are passed joined by newlines
+        function setNameFilters(filters) {
+            nameFilters = filters ? filters.split("\n") : [];
+        }
+
+        onAccepted: frontend.promptClosed(requestId, "accepted")
+        onRejected: frontend.promptClosed(requestId, "rejected")
     }
 }
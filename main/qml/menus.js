@@ -0,0 +1,70 @@
+.pragma library
+
+// Builds qml menus out of the menu items the frontend loads from
+// .sublime-menu files.
+
+// addItem adds the go menu item m to menu and returns a function updating
+// the state of the added item
+function addItem(menu, m) {
+    if (m.isSeparator()) {
+        menu.addSeparator();
+        return null;
+    }
+    if (m.childrenLen() > 0) {
+        var sub = menu.addMenu(m.text());
+        buildMenu(sub, m);
+        return null;
+    }
+    var item = menu.addItem(m.text());
+    item.checkable = m.checkbox;
+    item.triggered.connect(function() { m.run(); });
+    return function() {
+        item.visible = m.isVisible();
+        item.enabled = m.isEnabled();
+        if (m.checkbox) item.checked = m.isChecked();
+    };
+}
+
+// fillMenu adds the children of m to menu and returns a function updating
+// the state of the added items
+function fillMenu(menu, m) {
+    var updates = [];
+    for (var i = 0; i < m.childrenLen(); i++) {
+        var update = addItem(menu, m.child(i));
+        if (update) updates.push(update);
+    }
+    return function() {
+        for (var i = 0; i < updates.length; i++) updates[i]();
+    };
+}
+
+// buildMenu fills menu with the children of m, the state of the items is
+// queried whenever the menu is opened
+function buildMenu(menu, m) {
+    var update = fillMenu(menu, m);
+    menu.aboutToShow.connect(update);
+    update();
+}
+
+// popupMenu replaces the items of menu with the children of m and shows it
+// at the mouse position
+function popupMenu(menu, m) {
+    menu.clear();
+    if (m.childrenLen() == 0) return;
+    fillMenu(menu, m)();
+    menu.popup();
+}
+
+// buildMenuBar replaces the menus of menuBar with the children of m,
+// menuComponent creates the top level menus
+function buildMenuBar(menuBar, menuComponent, m) {
+    var menus = [];
+    for (var i = 0; i < m.childrenLen(); i++) {
+        var c = m.child(i);
+        if (c.isSeparator()) continue;
+        var menu = menuComponent.createObject(menuBar, {title: c.text()});
+        buildMenu(menu, c);
+        menus.push(menu);
+    }
+    menuBar.menus = menus;
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	. "github.com/limetext/text"
+)
+
+type searchOptions struct {
+	Regex         bool
+	CaseSensitive bool
+	WholeWord     bool
+	InSelection   bool
+	Wrap          bool
+}
+
+// compileSearch returns the regexp searching for pattern with the given
+// options
+func compileSearch(pattern string, opts searchOptions) (*regexp.Regexp, error) {
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.WholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	flags := "(?m)"
+	if !opts.CaseSensitive {
+		flags = "(?mi)"
+	}
+	return regexp.Compile(flags + pattern)
+}
+
+// findAll returns the regions of all non empty matches of re in text along
+// with their submatch byte offsets in text, as FindAllStringSubmatchIndex
+// returns them. The regions are in runes, like all buffer positions, offset
+// by base.
+func findAll(re *regexp.Regexp, text string, base int) ([]Region, [][]int) {
+	all := re.FindAllStringSubmatchIndex(text, -1)
+	regions := make([]Region, 0, len(all))
+	locs := make([][]int, 0, len(all))
+
+	bytePos, runePos := 0, base
+	toRunes := func(b int) int {
+		runePos += utf8.RuneCountInString(text[bytePos:b])
+		bytePos = b
+		return runePos
+	}
+	for _, loc := range all {
+		if loc[0] == loc[1] {
+			continue
+		}
+		a := toRunes(loc[0])
+		b := toRunes(loc[1])
+		regions = append(regions, Region{a, b})
+		locs = append(locs, loc)
+	}
+	return regions, locs
+}
+
+// regionsWithin returns the regions fully inside one of the scope regions
+// and the submatch offsets belonging to them
+func regionsWithin(regions []Region, locs [][]int, scope []Region) ([]Region, [][]int) {
+	var (
+		ret     []Region
+		retLocs [][]int
+	)
+	for i, r := range regions {
+		for _, s := range scope {
+			if s.Begin() <= r.Begin() && r.End() <= s.End() {
+				ret = append(ret, r)
+				retLocs = append(retLocs, locs[i])
+				break
+			}
+		}
+	}
+	return ret, retLocs
+}
+
+// expandMatch returns template with $1 and the like replaced by the
+// submatches of the match of re at loc in text
+func expandMatch(re *regexp.Regexp, template, text string, loc []int) string {
+	return string(re.ExpandString(nil, template, text, loc))
+}
+
+// nextMatch returns the index of the first match starting at or after pos,
+// or when searching backwards the last one ending at or before pos. Returns
+// -1 if there is none.
+func nextMatch(matches []Region, pos int, forward, wrap bool) int {
+	if len(matches) == 0 {
+		return -1
+	}
+	if forward {
+		i := sort.Search(len(matches), func(i int) bool { return matches[i].Begin() >= pos })
+		if i < len(matches) {
+			return i
+		}
+		if wrap {
+			return 0
+		}
+		return -1
+	}
+	i := sort.Search(len(matches), func(i int) bool { return matches[i].End() > pos }) - 1
+	if i >= 0 {
+		return i
+	}
+	if wrap {
+		return len(matches) - 1
+	}
+	return -1
+}
+
+// matchesIn returns the sorted matches intersecting r
+func matchesIn(matches []Region, r Region) []Region {
+	i := sort.Search(len(matches), func(i int) bool { return matches[i].End() > r.Begin() })
+	j := i
+	for j < len(matches) && matches[j].Begin() < r.End() {
+		j++
+	}
+	return matches[i:j]
+}
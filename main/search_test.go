@@ -0,0 +1,36 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestExpandMatch(t *testing.T) {
+	tests := []struct {
+		pattern, template, text string
+		exp                     []string
+	}{
+		{`(\w+)=(\w+)`, "$2=$1", "a=b, cd=ef", []string{"b=a", "ef=cd"}},
+		// anchors only match in the whole text
+		{`^(x)`, "<$1>", "x\nx y", []string{"<x>", "<x>"}},
+		{`é(\w)`, "${1}é", "éa bé éc", []string{"aé", "cé"}},
+		{`(a)`, "$$1", "a", []string{"$1"}},
+	}
+	for i, test := range tests {
+		re, err := compileSearch(test.pattern, searchOptions{Regex: true, CaseSensitive: true})
+		if err != nil {
+			t.Fatalf("Test %d: %s", i, err)
+		}
+		_, locs := findAll(re, test.text, 0)
+		if len(locs) != len(test.exp) {
+			t.Errorf("Test %d: Expected %d matches, got %d", i, len(test.exp), len(locs))
+			continue
+		}
+		for j, loc := range locs {
+			if s := expandMatch(re, test.template, test.text, loc); s != test.exp[j] {
+				t.Errorf("Test %d, %d: Expected %q, got %q", i, j, test.exp[j], s)
+			}
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+	. "github.com/limetext/text"
+)
+
+const (
+	sessionFile         = "Session.lime_session"
+	sessionSaveInterval = 5 * time.Minute
+)
+
+type (
+	// session is what we save on quit and restore on the next start
+	session struct {
+		Windows        []*windowSession `json:"windows"`
+		PathHistory    []string         `json:"path_history,omitempty"`
+		ConsoleHistory []string         `json:"console_history,omitempty"`
+	}
+
+	windowSession struct {
+		Geometry   *windowGeometry `json:"geometry"`
+		Folders    []string        `json:"folders,omitempty"`
+		Layout     *layout         `json:"layout,omitempty"`
+		Views      []*viewSession  `json:"views"`
+		ActiveView int             `json:"active_view"`
+
+		// filled in while restoring, used once the qml window is up
+		views  map[*backend.View]*viewSession
+		active *backend.View
+	}
+
+	windowGeometry struct {
+		X      int `json:"x"`
+		Y      int `json:"y"`
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	}
+
+	viewSession struct {
+		FileName string `json:"file_name,omitempty"`
+		Name     string `json:"name,omitempty"`
+		// Content is only stored for views with unsaved changes when
+		// hot_exit is enabled
+		Content    *string  `json:"content,omitempty"`
+		Syntax     string   `json:"syntax,omitempty"`
+		Selections []Region `json:"selections,omitempty"`
+		FirstRow   int      `json:"first_row"`
+		Group      int      `json:"group,omitempty"`
+	}
+)
+
+// sessionPath returns the path of the session file. It's kept out of the
+// packages as it may hold the content of unsaved buffers, and the User
+// package is often synced or committed.
+func sessionPath() string {
+	return filepath.Join(localPath, sessionFile)
+}
+
+// saveSession writes the state of all open windows to the session file
+func (f *frontend) saveSession() error {
+	ed := backend.GetEditor()
+	keepDirty := hotExit()
+
+	s := &session{
+		PathHistory:    f.pathHistory.list(),
+		ConsoleHistory: f.consoleHistory.list(),
+	}
+	for _, bw := range ed.Windows() {
+		if w := f.window(bw); w != nil && w.qw != nil {
+			s.Windows = append(s.Windows, w.session(keepDirty))
+		}
+	}
+	// happens while reloading qml or after all windows are closed, the last
+	// saved session is better than an empty one
+	if len(s.Windows) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(localPath, 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sessionPath(), data, 0600)
+}
+
+// autoSaveSession periodically saves the session so that not everything is
+// lost on a crash
+func (f *frontend) autoSaveSession() {
+	for range time.Tick(sessionSaveInterval) {
+		if err := f.saveSession(); err != nil {
+			log.Error("Couldn't save session: %s", err)
+		}
+	}
+}
+
+func (w *window) session(hotExit bool) *windowSession {
+	ws := &windowSession{
+		Geometry: &windowGeometry{
+			X:      w.qw.Int("x"),
+			Y:      w.qw.Int("y"),
+			Width:  w.qw.Int("width"),
+			Height: w.qw.Int("height"),
+		},
+		Folders: w.bw.Project().Folders(),
+	}
+	w.groupsLock.Lock()
+	l := w.layout
+	w.groupsLock.Unlock()
+	ws.Layout = &l
+
+	active := w.bw.ActiveView()
+	for _, bv := range w.bw.Views() {
+		vs := newViewSession(bv, w.view(bv), hotExit)
+		if vs == nil {
+			continue
+		}
+		vs.Group, _ = w.viewIndex(bv)
+		if bv == active {
+			ws.ActiveView = len(ws.Views)
+		}
+		ws.Views = append(ws.Views, vs)
+	}
+	return ws
+}
+
+// newViewSession returns the session of bv or nil if there is nothing worth
+// restoring, like an empty untitled buffer
+func newViewSession(bv *backend.View, v *view, hotExit bool) *viewSession {
+	vs := &viewSession{
+		FileName:   bv.FileName(),
+		Name:       bv.Name(),
+		Syntax:     bv.Settings().String("syntax", ""),
+		Selections: bv.Sel().Regions(),
+	}
+	if hotExit && bv.IsDirty() {
+		content := bv.Substr(Region{0, bv.Size()})
+		vs.Content = &content
+	}
+	if vs.FileName == "" && vs.Content == nil {
+		return nil
+	}
+	if v != nil {
+		v.visibleLock.Lock()
+		vs.FirstRow = v.firstRow
+		v.visibleLock.Unlock()
+	}
+	return vs
+}
+
+// restoreSession creates the backend windows and views of the last session.
+// The rest of the state is applied once the qml windows are created, see
+// applySession. Returns false if there was no session to restore.
+func (f *frontend) restoreSession() bool {
+	data, err := ioutil.ReadFile(sessionPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("Couldn't read session: %s", err)
+		}
+		return false
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		log.Error("Couldn't parse session: %s", err)
+		return false
+	}
+	f.pathHistory.set(s.PathHistory)
+	f.consoleHistory.set(s.ConsoleHistory)
+	if len(s.Windows) == 0 {
+		return false
+	}
+
+	ed := backend.GetEditor()
+	for _, ws := range s.Windows {
+		bw := ed.NewWindow()
+		for _, folder := range ws.Folders {
+			bw.Project().AddFolder(folder)
+		}
+		ws.views = make(map[*backend.View]*viewSession)
+		for i, vs := range ws.Views {
+			bv := vs.restore(bw)
+			if bv == nil {
+				continue
+			}
+			ws.views[bv] = vs
+			if i == ws.ActiveView {
+				ws.active = bv
+			}
+		}
+		if len(bw.Views()) == 0 {
+			bw.NewFile()
+		}
+		f.lock.Lock()
+		f.restored[bw] = ws
+		f.lock.Unlock()
+	}
+	return true
+}
+
+func (vs *viewSession) restore(bw *backend.Window) *backend.View {
+	var bv *backend.View
+	if _, err := os.Stat(vs.FileName); err == nil {
+		bv = bw.OpenFile(vs.FileName, 0)
+	} else if vs.Content != nil {
+		// untitled, or the file was removed since but we still have its
+		// content
+		bv = bw.NewFile()
+		if vs.FileName != "" {
+			bv.SetFileName(vs.FileName)
+		}
+	} else {
+		log.Warn("Not restoring %s: %s", vs.FileName, err)
+		return nil
+	}
+	if vs.Name != "" {
+		bv.SetName(vs.Name)
+	}
+	if vs.Syntax != "" {
+		bv.Settings().Set("syntax", vs.Syntax)
+	}
+	if vs.Content != nil {
+		e := bv.BeginEdit()
+		bv.Replace(e, Region{0, bv.Size()}, *vs.Content)
+		bv.EndEdit(e)
+	}
+	if len(vs.Selections) > 0 {
+		size := bv.Size()
+		bv.Sel().Clear()
+		for _, r := range vs.Selections {
+			bv.Sel().Add(Region{clamp(r.A, 0, size), clamp(r.B, 0, size)})
+		}
+	}
+	return bv
+}
+
+func clamp(i, min, max int) int {
+	if i < min {
+		return min
+	}
+	if i > max {
+		return max
+	}
+	return i
+}
+
+// restoredSession returns the session bw was restored from while it's
+// being restored, or nil
+func (f *frontend) restoredSession(bw *backend.Window) *windowSession {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.restored[bw]
+}
+
+// applySession restores the state of a restored window that needs the qml
+// window to exist. It has to be called after the window was launched but
+// before its views are added.
+func (f *frontend) applySession(w *window) {
+	ws := f.restoredSession(w.bw)
+	if ws == nil || ws.Layout == nil {
+		return
+	}
+	if err := ws.Layout.check(); err != nil {
+		log.Warn("Not restoring the layout: %s", err)
+		return
+	}
+	w.setLayout(*ws.Layout)
+}
+
+// applyViewSessions restores the scroll positions and active tab of a
+// restored window once its views were added.
+func (f *frontend) applyViewSessions(w *window) {
+	f.lock.Lock()
+	ws := f.restored[w.bw]
+	delete(f.restored, w.bw)
+	f.lock.Unlock()
+	if ws == nil {
+		return
+	}
+
+	for bv, vs := range ws.views {
+		if v := w.view(bv); v != nil {
+			p := bv.TextPoint(vs.FirstRow, 0)
+			v.show(Region{p, p}, showAtTop|keepToLeft)
+		}
+	}
+	if v := w.view(ws.active); v != nil {
+		w.qw.Call("activateTab", v.id)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/limetext/backend"
+)
+
+// statusItem is a label of the status bar. Clicking it either runs its
+// command or pops up the menu returned by menu, both apply to the view the
+// item belongs to.
+type statusItem struct {
+	Key  string
+	Text string
+	// shown on the right side, like the indentation and syntax
+	Right bool
+
+	bv      *backend.View
+	command string
+	args    backend.Args
+	menu    func(bv *backend.View) *menuItem
+}
+
+// Click is called from QML when the item is clicked, the returned menu is
+// popped up if there is one
+func (s *statusItem) Click() *menuItem {
+	if s.menu != nil {
+		m := s.menu(s.bv)
+		m.setContext(&menuContext{bv: s.bv})
+		return m
+	}
+	if s.command != "" {
+		go runCommandOn(s.bv, s.command, s.args)
+	}
+	return nil
+}
+
+func (s *statusItem) IsClickable() bool {
+	return s.menu != nil || s.command != ""
+}
+
+// statusCommand is an entry of the status_commands setting, which maps
+// set_status keys to the command run when their item is clicked
+type statusCommand struct {
+	Command string       `json:"command"`
+	Args    backend.Args `json:"args"`
+}
+
+// statusCommands returns the status_commands setting of bv
+func statusCommands(bv *backend.View) map[string]statusCommand {
+	ret := make(map[string]statusCommand)
+	setting, ok := bv.Settings().Get("status_commands", nil).(map[string]interface{})
+	if !ok {
+		return ret
+	}
+	for key, v := range setting {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var sc statusCommand
+		sc.Command, _ = m["command"].(string)
+		if args, ok := m["args"].(map[string]interface{}); ok {
+			sc.Args = backend.Args(args)
+		}
+		ret[key] = sc
+	}
+	return ret
+}
+
+// updateStatus turns the set_status values of the view into status items,
+// sorted by their key
+func (v *view) updateStatus() {
+	status := v.bv.Status()
+	keys := make([]string, 0, len(status))
+	for k := range status {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	cmds := statusCommands(v.bv)
+	items := make([]*statusItem, 0, len(keys))
+	for _, k := range keys {
+		if status[k] == "" {
+			continue
+		}
+		it := &statusItem{Key: k, Text: status[k], bv: v.bv}
+		if sc, ok := cmds[k]; ok {
+			it.command = sc.Command
+			it.args = sc.Args
+		}
+		items = append(items, it)
+	}
+
+	v.statusLock.Lock()
+	v.statusItems = items
+	v.StatusLen = len(items)
+	v.StatusVersion++
+	v.statusLock.Unlock()
+	fe.qmlChanged(v, &v.StatusLen)
+	fe.qmlChanged(v, &v.StatusVersion)
+}
+
+// updateSegments updates the built-in status items
+func (v *view) updateSegments() {
+	bv := v.bv
+	settings := bv.Settings()
+	var segments []*statusItem
+
+	rs := bv.Sel().Regions()
+	if len(rs) > 0 {
+		row, col := bv.RowCol(rs[0].B)
+		segments = append(segments, &statusItem{
+			Key:     "position",
+			Text:    fmt.Sprintf("Line %d, Column %d", row+1, col+1),
+			command: "show_overlay",
+			args:    backend.Args{"overlay": "goto", "text": ":"},
+		})
+	}
+	selection := ""
+	if len(rs) > 1 {
+		selection = fmt.Sprintf("%d selection regions", len(rs))
+	} else if len(rs) == 1 && !rs[0].Empty() {
+		selection = fmt.Sprintf("%d characters selected", rs[0].Size())
+	}
+	if selection != "" {
+		segments = append(segments, &statusItem{Key: "selection", Text: selection, menu: selectionMenu})
+	}
+
+	tabSize := settings.Int("tab_size", 4)
+	spaces := settings.Bool("translate_tabs_to_spaces", false)
+	indentation := fmt.Sprintf("Tab Size: %d", tabSize)
+	if spaces {
+		indentation = fmt.Sprintf("Spaces: %d", tabSize)
+	}
+	segments = append(segments,
+		&statusItem{Key: "indentation", Text: indentation, Right: true, menu: indentationMenu},
+		&statusItem{Key: "line_endings", Text: lineEndingName(lineEnding(bv)), Right: true, menu: lineEndingsMenu},
+		&statusItem{Key: "encoding", Text: bv.Encoding(), Right: true, menu: encodingMenu},
+		&statusItem{Key: "syntax", Text: syntaxName(settings.String("syntax", "Plain Text")), Right: true, menu: syntaxMenu},
+	)
+	for _, s := range segments {
+		s.bv = bv
+	}
+
+	v.statusLock.Lock()
+	v.segments = segments
+	v.SegmentsLen = len(segments)
+	v.StatusVersion++
+	v.statusLock.Unlock()
+	fe.qmlChanged(v, &v.SegmentsLen)
+	fe.qmlChanged(v, &v.StatusVersion)
+}
+
+// StatusItem is called from QML to get the i-th set_status item
+func (v *view) StatusItem(i int) *statusItem {
+	v.statusLock.Lock()
+	defer v.statusLock.Unlock()
+	if i < 0 || i >= len(v.statusItems) {
+		return nil
+	}
+	return v.statusItems[i]
+}
+
+// Segment is called from QML to get the i-th built-in status item
+func (v *view) Segment(i int) *statusItem {
+	v.statusLock.Lock()
+	defer v.statusLock.Unlock()
+	if i < 0 || i >= len(v.segments) {
+		return nil
+	}
+	return v.segments[i]
+}
+
+// lineEnding returns the line ending of bv as the type arg of
+// set_line_ending, one of "windows", "unix" or "cr"
+func lineEnding(bv *backend.View) string {
+	return strings.ToLower(bv.LineEndings())
+}
+
+func lineEndingName(ending string) string {
+	switch ending {
+	case "windows":
+		return "Windows"
+	case "unix":
+		return "Unix"
+	case "cr":
+		return "Mac OS 9"
+	}
+	return ending
+}
+
+// checkedItem returns a menu item running command with args, shown as
+// checked if current is set
+func checkedItem(caption, command string, args backend.Args, current bool) *menuItem {
+	return &menuItem{
+		Caption:  caption,
+		Command:  command,
+		Args:     args,
+		Checkbox: true,
+		checked:  func() bool { return current },
+	}
+}
+
+// settingItem returns a menu item setting the view setting name to value,
+// shown as checked if it's the current value
+func settingItem(caption, name string, value interface{}, current bool) *menuItem {
+	return checkedItem(caption, "set_setting", backend.Args{"setting": name, "value": value}, current)
+}
+
+func selectionMenu(bv *backend.View) *menuItem {
+	return &menuItem{Children: []*menuItem{
+		{Caption: "Single Selection", Command: "single_selection"},
+		{Caption: "Split into Lines", Command: "split_selection_into_lines"},
+		{Caption: "Expand Selection to Line", Command: "expand_selection", Args: backend.Args{"to": "line"}},
+		{Caption: "-"},
+		{Caption: "Select All", Command: "select_all"},
+	}}
+}
+
+func indentationMenu(bv *backend.View) *menuItem {
+	tabSize := bv.Settings().Int("tab_size", 4)
+	spaces := bv.Settings().Bool("translate_tabs_to_spaces", false)
+	m := &menuItem{Children: []*menuItem{
+		{Caption: "Indent Using Spaces", Command: "toggle_setting", Args: backend.Args{"setting": "translate_tabs_to_spaces"},
+			Checkbox: true, checked: func() bool { return spaces }},
+		{Caption: "-"},
+	}}
+	for i := 1; i <= 8; i++ {
+		m.Children = append(m.Children, settingItem(fmt.Sprintf("Tab Width: %d", i), "tab_size", i, i == tabSize))
+	}
+	m.Children = append(m.Children,
+		&menuItem{Caption: "-"},
+		&menuItem{Caption: "Convert Indentation to Spaces", Command: "expand_tabs", Args: backend.Args{"set_translate_tabs": true}},
+		&menuItem{Caption: "Convert Indentation to Tabs", Command: "unexpand_tabs", Args: backend.Args{"set_translate_tabs": true}},
+	)
+	return m
+}
+
+func lineEndingsMenu(bv *backend.View) *menuItem {
+	current := lineEnding(bv)
+	m := &menuItem{}
+	for _, ending := range []string{"windows", "unix", "cr"} {
+		m.Children = append(m.Children, checkedItem(lineEndingName(ending), "set_line_ending", backend.Args{"type": ending}, ending == current))
+	}
+	return m
+}
+
+// encodingMenu lists the encodings a view can be saved with
+func encodingMenu(bv *backend.View) *menuItem {
+	current := bv.Encoding()
+	m := &menuItem{}
+	for _, enc := range []string{"UTF-8", "UTF-8 with BOM", "UTF-16 LE", "UTF-16 BE", "Western (Windows 1252)", "Western (ISO 8859-1)"} {
+		m.Children = append(m.Children, checkedItem(enc, "set_encoding", backend.Args{"encoding": enc}, enc == current))
+	}
+	return m
+}
+
+// syntaxMenu lists the syntaxes of all packages
+func syntaxMenu(bv *backend.View) *menuItem {
+	current := bv.Settings().String("syntax", "")
+	m := &menuItem{}
+	for _, fn := range syntaxFiles() {
+		name := strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+		m.Children = append(m.Children, settingItem(name, "syntax", fn, fn == current))
+	}
+	return m
+}
@@ -55,6 +55,33 @@ class EventListener(object):
     pass
 
 
+# listeners of events the frontend fires itself, by method name
+_frontend_listeners = {"on_visible_region_changed": []}
+
+
+def _find_view(view_id):
+    for w in sublime.windows():
+        for v in w.views():
+            if v.id() == view_id:
+                return v
+    return None
+
+
+def on_visible_region_changed(view_id):
+    """Called by the frontend when a view was scrolled or resized."""
+    listeners = _frontend_listeners["on_visible_region_changed"]
+    if not listeners:
+        return
+    view = _find_view(view_id)
+    if view is None:
+        return
+    for cb in listeners:
+        try:
+            cb(view)
+        except:
+            traceback.print_exc()
+
+
 def fn(fullname):
     paths = fullname.split(".")
     paths = "/".join(paths)
@@ -121,6 +148,10 @@ def reload_plugin(module):
                         toadd = getattr(inst, name, None)
                         if toadd:
                             sublime.ViewEventGlue(toadd, name)
+                    for name, listeners in _frontend_listeners.items():
+                        toadd = getattr(inst, name, None)
+                        if toadd:
+                            listeners.append(toadd)
                 elif issubclass(item[1], TextCommand):
                     sublime.register(cmd, sublime.TextCommandGlue(item[1]))
                 elif issubclass(item[1], WindowCommand):
@@ -135,6 +166,43 @@ def reload_plugin(module):
         traceback.print_exc()
 
 
+def _yes_no_cancel_dialog(msg, yes_title="", no_title=""):
+    import lime
+    return lime.yes_no_cancel_dialog(msg, yes_title, no_title)
+
+# Dialogs the frontend provides through the lime module
+for _name, _value in [("DIALOG_CANCEL", 0),
+                      ("DIALOG_YES", 1),
+                      ("DIALOG_NO", 2),
+                      ("yes_no_cancel_dialog", _yes_no_cancel_dialog)]:
+    if not hasattr(sublime, _name):
+        setattr(sublime, _name, _value)
+
+
+# The namespace of the code entered in the console, kept between inputs
+_console_namespace = {"sublime": sublime, "sublime_plugin": sys.modules[__name__]}
+
+
+def console_eval(code):
+    """Runs code entered in the console. Expressions have their value
+    printed, like in the interactive interpreter."""
+    print(">>> %s" % code)
+    window = sublime.active_window()
+    _console_namespace["window"] = window
+    _console_namespace["view"] = window.active_view() if window else None
+    try:
+        try:
+            compiled = compile(code, "<console>", "eval")
+        except SyntaxError:
+            compiled = compile(code, "<console>", "exec")
+        result = eval(compiled, _console_namespace)
+        if result is not None:
+            _console_namespace["_"] = result
+            print(repr(result))
+    except:
+        traceback.print_exc()
+
+
 class MyLogger:
 
     def __init__(self):
@@ -0,0 +1,245 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
+)
+
+// DropTab is called from QML when the tab of the view was dragged and
+// dropped at x, y relative to the window it was dragged from
+func (v *view) DropTab(x, y float64) {
+	go fe.dropView(v.bv, int(x), int(y))
+}
+
+// dropView moves bv to the group and tab position of the window under x, y,
+// relative to the window of bv. Dropping it outside of all windows moves it
+// to a new window.
+func (f *frontend) dropView(bv *backend.View, x, y int) {
+	src := f.window(bv.Window())
+	if src == nil || src.qw == nil {
+		return
+	}
+	// the qml windows only know their own coordinates
+	x += src.qw.Int("x")
+	y += src.qw.Int("y")
+
+	// the source window goes first as windows may overlap
+	windows := []*window{src}
+	for _, w := range f.windowList() {
+		if w != src {
+			windows = append(windows, w)
+		}
+	}
+	for _, w := range windows {
+		if w.qw == nil {
+			continue
+		}
+		wx, wy := x-w.qw.Int("x"), y-w.qw.Int("y")
+		if wx < 0 || wy < 0 || wx >= w.qw.Int("width") || wy >= w.qw.Int("height") {
+			continue
+		}
+		group, ok := intValue(w.qw.Call("groupAt", wx, wy))
+		if !ok || group < 0 {
+			// dropped onto a panel or the status bar
+			return
+		}
+		index, ok := intValue(w.qw.Call("tabIndexAt", group, wx, wy))
+		if !ok {
+			index = -1
+		}
+		if w == src {
+			w.setViewIndex(bv, group, index)
+		} else {
+			f.moveToWindow(bv, w, group, index)
+		}
+		return
+	}
+
+	bw := backend.GetEditor().NewWindow()
+	if w := f.window(bw); w != nil && w.qw != nil {
+		w.qw.Set("x", x)
+		w.qw.Set("y", y)
+		f.moveToWindow(bv, w, 0, -1)
+	}
+}
+
+// moveToWindow moves bv to index in group of the window w. It stays the same
+// view, keeping its undo history, and as it's neither closed nor created
+// again no events fire for it.
+func (f *frontend) moveToWindow(bv *backend.View, w *window, group, index int) {
+	src := f.window(bv.Window())
+	if src == nil || src == w {
+		return
+	}
+	if err := src.bw.MoveView(bv, w.bw); err != nil {
+		log.Error("Couldn't move %s to another window: %s", viewName(bv), err)
+		return
+	}
+
+	v := src.forgetView(bv)
+	src.removeView(bv)
+	if res := src.FindInFiles.forget(bv); res != nil {
+		w.FindInFiles.adopt(bv, res)
+	}
+	if src.qw != nil && v != nil {
+		src.qw.Call("removeTab", v.id)
+	}
+	if views := src.bw.Views(); len(views) > 0 && src.bw.ActiveView() == nil {
+		src.bw.SetActiveView(views[len(views)-1])
+	}
+
+	if v == nil {
+		v = newView(bv)
+	}
+	w.setView(bv, v)
+	w.addView(bv, group)
+	if w.qw != nil {
+		w.qw.Call("addTab", v.id, v, group)
+	}
+	w.setViewIndex(bv, group, index)
+	w.bw.SetActiveView(bv)
+	f.updateTitles()
+}
+
+// the longest title of untitled views, which are named after their first
+// line
+const untitledTitleLen = 50
+
+// baseTitle returns the title of bv without the parent path telling views of
+// files with the same base name apart
+func baseTitle(bv *backend.View) string {
+	if name := bv.Name(); name != "" {
+		return name
+	}
+	if fn := bv.FileName(); fn != "" {
+		return filepath.Base(fn)
+	}
+	return untitledTitle(bv.Substr(bv.Line(0)))
+}
+
+// untitledTitle returns the title of an untitled view with the first line
+func untitledTitle(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "untitled"
+	}
+	if utf8.RuneCountInString(line) > untitledTitleLen {
+		line = string([]rune(line)[:untitledTitleLen]) + "…"
+	}
+	return line
+}
+
+// parentSuffixes returns the shortest trailing part of the parent directory
+// of each path that none of the other paths has. It's empty for paths that
+// can't be told apart, like the same file opened twice.
+func parentSuffixes(paths []string) []string {
+	dirs := make([][]string, len(paths))
+	for i, p := range paths {
+		dirs[i] = strings.Split(filepath.ToSlash(filepath.Dir(p)), "/")
+	}
+	suffix := func(dir []string, n int) string {
+		if n > len(dir) {
+			n = len(dir)
+		}
+		return strings.Join(dir[len(dir)-n:], "/")
+	}
+
+	ret := make([]string, len(paths))
+	for i, dir := range dirs {
+	outer:
+		for n := 1; n <= len(dir); n++ {
+			s := suffix(dir, n)
+			for j, other := range dirs {
+				if j != i && suffix(other, n) == s {
+					continue outer
+				}
+			}
+			ret[i] = filepath.FromSlash(s)
+			break
+		}
+	}
+	return ret
+}
+
+// setTitle updates the tab title of v
+func (v *view) setTitle(title string, dirty bool) {
+	if v.Title != title {
+		v.Title = title
+		fe.qmlChanged(v, &v.Title)
+	}
+	if v.Dirty != dirty {
+		v.Dirty = dirty
+		fe.qmlChanged(v, &v.Dirty)
+	}
+}
+
+// updateTitles updates the titles of all views. The title of a file
+// depends on the other open files, files with the same base name get the
+// part of their parent path telling them apart appended.
+func (f *frontend) updateTitles() {
+	var views []*view
+	byBase := make(map[string][]*view)
+	titles := make(map[*view]string)
+	for _, w := range f.windowList() {
+		for bv, v := range w.viewMap() {
+			base := baseTitle(bv)
+			views = append(views, v)
+			titles[v] = base
+			if bv.Name() == "" && bv.FileName() != "" {
+				byBase[base] = append(byBase[base], v)
+			}
+		}
+	}
+
+	for base, same := range byBase {
+		if len(same) < 2 {
+			continue
+		}
+		paths := make([]string, len(same))
+		for i, v := range same {
+			paths[i] = v.bv.FileName()
+		}
+		for i, s := range parentSuffixes(paths) {
+			if s != "" {
+				titles[same[i]] = base + " — " + s
+			}
+		}
+	}
+
+	for _, v := range views {
+		v.setTitle(titles[v], v.bv.IsDirty())
+	}
+}
+
+// updateTitle updates the dirty marker of bv, and the title of untitled
+// views which changes with their first line. A view renamed with set_name
+// may change the titles of the other views, so all of them are updated.
+func (f *frontend) updateTitle(bv *backend.View) {
+	v := f.view(bv)
+	if v == nil || v == f.Console {
+		return
+	}
+	if bv.Name() == "" && bv.FileName() == "" {
+		v.setTitle(baseTitle(bv), bv.IsDirty())
+		return
+	}
+	base := baseTitle(bv)
+	renamed := v.Title != base
+	if bv.Name() == "" {
+		// files may have their parent path appended
+		renamed = renamed && !strings.HasPrefix(v.Title, base+" — ")
+	}
+	if renamed {
+		f.updateTitles()
+		return
+	}
+	v.setTitle(v.Title, bv.IsDirty())
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 The lime Authors.
+// Use of this source code is governed by a 2-clause
+// BSD-style license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParentSuffixes(t *testing.T) {
+	tests := []struct {
+		paths []string
+		exp   []string
+	}{
+		{
+			[]string{"/a/b/main.go", "/a/c/main.go"},
+			[]string{"b", "c"},
+		},
+		{
+			[]string{"/x/src/main.go", "/y/src/main.go", "/y/lib/main.go"},
+			[]string{"x/src", "y/src", "lib"},
+		},
+		{
+			[]string{"/a/b/c/f", "/b/c/f"},
+			[]string{"a/b/c", "/b/c"},
+		},
+		// the same file twice can't be told apart
+		{
+			[]string{"/a/f", "/a/f", "/b/f"},
+			[]string{"", "", "b"},
+		},
+	}
+
+	for i, test := range tests {
+		paths := make([]string, len(test.paths))
+		exp := make([]string, len(test.exp))
+		for j := range test.paths {
+			paths[j] = filepath.FromSlash(test.paths[j])
+			exp[j] = filepath.FromSlash(test.exp[j])
+		}
+		if got := parentSuffixes(paths); !reflect.DeepEqual(got, exp) {
+			t.Errorf("Test %d: Expected %q, but got %q", i, exp, got)
+		}
+	}
+}
+
+func TestUntitledTitle(t *testing.T) {
+	long := strings.Repeat("x", untitledTitleLen+10)
+	tests := []struct {
+		line string
+		exp  string
+	}{
+		{"", "untitled"},
+		{"   \t", "untitled"},
+		{"  hello world ", "hello world"},
+		{"ünïcödé", "ünïcödé"},
+		{long, long[:untitledTitleLen] + "…"},
+	}
+
+	for i, test := range tests {
+		if got := untitledTitle(test.line); got != test.exp {
+			t.Errorf("Test %d: Expected %q, but got %q", i, test.exp, got)
+		}
+	}
+}
@@ -6,7 +6,7 @@ package main
 
 import (
 	"fmt"
-	"sort"
+	"math"
 	"sync"
 
 	"github.com/limetext/backend"
@@ -20,14 +20,38 @@ import (
 // A helper glue structure connecting the backend View with the qml code that
 // then ends up rendering it.
 type view struct {
-	id              int
-	bv              *backend.View
-	qv              qml.Object
-	FormattedLines  *linesList
-	linesLock       sync.Mutex
-	Title           string
-	Status          string
-	SelectionStatus string // like line and column position
+	id             int
+	bv             *backend.View
+	qv             qml.Object
+	FormattedLines *linesList
+	linesLock      sync.Mutex
+	Title          string
+	Dirty          bool // whether the tab shows the unsaved changes marker
+
+	// the status bar items, see statusbar.go. StatusVersion changes
+	// whenever the items do.
+	statusLock    sync.Mutex
+	statusItems   []*statusItem
+	segments      []*statusItem
+	StatusLen     int
+	SegmentsLen   int
+	StatusVersion int
+
+	// show request made before the qml view was ready. It's made on
+	// backend goroutines and applied from QML.
+	showLock    sync.Mutex
+	pendingShow *showRequest
+
+	// first and last row visible in the qml view, lastRow is -1 until the
+	// qml view reports its viewport
+	visibleLock sync.Mutex
+	firstRow    int
+	lastRow     int
+	// set while listeners are about to be told of a new visible region
+	visiblePending bool
+
+	// sorted regions highlighted as search matches, guarded by linesLock
+	matches []Region
 
 	watchedSettings map[string]watchedSetting
 
@@ -38,14 +62,17 @@ type view struct {
 	FontFace   string `setting:"font_face"`
 }
 
+type showRequest struct {
+	r     Region
+	flags int
+}
+
 func newView(bv *backend.View) *view {
 	v := &view{
-		id:    int(bv.Id()),
-		bv:    bv,
-		Title: bv.FileName(),
-	}
-	if len(v.Title) == 0 {
-		v.Title = "untitled"
+		id:      int(bv.Id()),
+		bv:      bv,
+		Title:   baseTitle(bv),
+		lastRow: -1,
 	}
 	bv.AddObserver(v)
 	bv.Settings().AddOnChange("qml.view", v.onSettingChange)
@@ -53,18 +80,23 @@ func newView(bv *backend.View) *view {
 	watcher := newSettingsWatcher(v, bv.Settings())
 
 	watcher.watchInt("tab_size", &v.TabSize, 4)
-	watcher.watchString("syntax", &v.SyntaxName, "Plain Text", func(syn string) string {
-		if syntax := backend.GetEditor().GetSyntax(syn); syntax != nil {
-			return syntax.Name()
-		}
-		return syn
-	})
+	watcher.watchString("syntax", &v.SyntaxName, "Plain Text", syntaxName)
 	watcher.watchInt("font_size", &v.FontSize, 10)
 	watcher.watchString("font_face", &v.FontFace, "Monospace")
 
+	v.updateStatus()
+	v.updateSegments()
 	return v
 }
 
+// syntaxName returns the name of the syntax definition file syn
+func syntaxName(syn string) string {
+	if syntax := backend.GetEditor().GetSyntax(syn); syntax != nil {
+		return syntax.Name()
+	}
+	return syn
+}
+
 // htmlcol returns the hex color value for the given Colour object
 func htmlcol(c render.Colour) string {
 	return fmt.Sprintf("%02X%02X%02X", c.R, c.G, c.B)
@@ -122,9 +154,109 @@ func (v *view) Fix(obj qml.Object) {
 
 }
 
+// LinesReady is called from QML once the formatted lines are bound to the
+// qml view, so show requests made before that can be applied
+func (v *view) LinesReady() {
+	v.showLock.Lock()
+	req := v.pendingShow
+	v.pendingShow = nil
+	v.showLock.Unlock()
+	if req != nil {
+		v.show(req.r, req.flags)
+	}
+}
+
+// show scrolls the qml view to r, see frontend.show for the flags
+func (v *view) show(r Region, flags int) {
+	v.showLock.Lock()
+	if v.qv == nil || v.FormattedLines == nil {
+		v.pendingShow = &showRequest{r, flags}
+		v.showLock.Unlock()
+		return
+	}
+	v.showLock.Unlock()
+	row1, _ := v.bv.RowCol(r.Begin())
+	row2, _ := v.bv.RowCol(r.End())
+	row, col := v.bv.RowCol(r.B)
+	v.qv.Call("show", row1, row2, row, col, flags)
+}
+
+// ViewportChanged is called from QML when the buffer is scrolled or resized
+func (v *view) ViewportChanged(contentY, height, lineHeight float64) {
+	if lineHeight <= 0 {
+		return
+	}
+	first := int(contentY / lineHeight)
+	last := int(math.Ceil((contentY+height)/lineHeight)) - 1
+	if rows, _ := v.bv.RowCol(v.bv.Size()); last > rows {
+		last = rows
+	}
+	if first < 0 {
+		first = 0
+	}
+	if last < first {
+		last = first
+	}
+
+	v.visibleLock.Lock()
+	changed := v.firstRow != first || v.lastRow != last
+	v.firstRow, v.lastRow = first, last
+	// while scrolling plugins are told once they caught up
+	notify := changed && !v.visiblePending
+	if notify {
+		v.visiblePending = true
+	}
+	v.visibleLock.Unlock()
+
+	if notify {
+		go v.visibleRegionChanged()
+	}
+}
+
+// visibleRegionChanged fires OnVisibleRegionChanged for Go and python
+// listeners
+func (v *view) visibleRegionChanged() {
+	v.visibleLock.Lock()
+	v.visiblePending = false
+	v.visibleLock.Unlock()
+
+	OnVisibleRegionChanged.Call(v.bv)
+	if err := callPlugin("on_visible_region_changed", int(v.bv.Id())); err != nil {
+		log.Error("Couldn't notify plugins of the visible region: %s", err)
+	}
+}
+
+// visibleRegion returns the region of the buffer currently shown in the
+// qml view, or the whole buffer if that isn't known yet
+func (v *view) visibleRegion() Region {
+	v.visibleLock.Lock()
+	first, last := v.firstRow, v.lastRow
+	v.visibleLock.Unlock()
+
+	if last < 0 {
+		return Region{0, v.bv.Size()}
+	}
+	a := v.bv.TextPoint(first, 0)
+	b := v.bv.Line(v.bv.TextPoint(last, 0)).End()
+	return Region{a, b}
+}
+
+// ActivateLine is called from QML when a line is double clicked, it opens
+// the location shown at row if this is a find results view
+func (v *view) ActivateLine(row int) bool {
+	w := fe.window(v.bv.Window())
+	if w == nil {
+		return false
+	}
+	return w.FindInFiles.open(v.bv, row)
+}
+
 // SetActive is called from QML when the active tab is set to this view
 func (v *view) SetActive() {
-	v.bv.Window().SetActiveView(v.bv)
+	// the console has no window
+	if bw := v.bv.Window(); bw != nil && bw.ActiveView() != v.bv {
+		bw.SetActiveView(v.bv)
+	}
 }
 
 func (v *view) Erased(changed_buffer Buffer, region_removed Region, data_removed []rune) {
@@ -204,6 +336,8 @@ func (v *view) onSettingChange(name string) {
 	fmt.Printf("SettingChanged: %s %v\n", name, settings.Get(name))
 
 	switch name {
+	case "tab_size", "translate_tabs_to_spaces", "syntax":
+		v.updateSegments()
 	case "lime.syntax.updated":
 		// force redraw, as the syntax regions might have changed...
 		for i := 0; i < v.FormattedLines.len(); i++ {
@@ -222,6 +356,7 @@ func (v *view) formatLine(linenum int, line *lineStruct) {
 		if line.Text != "" {
 			line.Text = ""
 			line.Chunks = line.Chunks[0:0]
+			line.Version++
 			fe.qmlChanged(line, line)
 		}
 		return
@@ -244,19 +379,47 @@ func (v *view) formatLine(linenum int, line *lineStruct) {
 		chunkI += 1
 	}
 
+	// addChunk adds the chunk for r, split up where search matches begin
+	// and end so that those parts can be highlighted
+	matches := matchesIn(v.matches, vr)
+	addChunk := func(r Region, lc lineChunk) {
+		a, b := r.Begin(), r.End()
+		for _, m := range matchesIn(matches, r) {
+			if m.Begin() > a {
+				lc.Text = v.bv.Substr(Region{a, m.Begin()})
+				nextChunk(lc)
+				a = m.Begin()
+			}
+			end := m.End()
+			if end > b {
+				end = b
+			}
+			mc := lineChunk{
+				Text:       v.bv.Substr(Region{a, end}),
+				Foreground: findHighlightForeground,
+				Background: findHighlightBackground,
+				Match:      true,
+			}
+			nextChunk(mc)
+			a = end
+		}
+		if a < b {
+			lc.Text = v.bv.Substr(Region{a, b})
+			nextChunk(lc)
+		}
+	}
+
 	for _, reg := range recipie {
 		if lastEnd != reg.Region.Begin() {
-			lc := lineChunk{Text: v.bv.Substr(Region{lastEnd, reg.Region.Begin()})}
-			nextChunk(lc)
+			addChunk(Region{lastEnd, reg.Region.Begin()}, lineChunk{})
 		}
-		lc := lineChunk{Text: v.bv.Substr(reg.Region), Foreground: htmlcol(reg.Flavour.Foreground), Background: htmlcol(reg.Flavour.Background)}
-		nextChunk(lc)
+		lc := lineChunk{Foreground: htmlcol(reg.Flavour.Foreground), Background: htmlcol(reg.Flavour.Background)}
+		addChunk(reg.Region, lc)
 
 		lastEnd = reg.Region.End()
 	}
 	if lastEnd != vr.End() {
-		lc := lineChunk{Text: v.bv.Substr(Region{lastEnd, vr.End()})}
-		nextChunk(lc)
+		addChunk(Region{lastEnd, vr.End()}, lineChunk{})
 	}
 
 	if chunkI != len(chunks) {
@@ -267,38 +430,37 @@ func (v *view) formatLine(linenum int, line *lineStruct) {
 	if changed {
 		line.Text = v.bv.Substr(vr)
 		line.Chunks = chunks
+		line.Version++
 		fe.qmlChanged(line, line)
 	}
 }
 
-func (v *view) updateStatus() {
-	statusMap := v.Back().Status()
-	ks := make([]string, 0, len(statusMap))
-	for k := range statusMap {
-		ks = append(ks, k)
-	}
-	sort.Strings(ks)
+// setMatches sets the regions highlighted as search matches and reformats
+// the lines whose highlighting changed
+func (v *view) setMatches(matches []Region) {
+	v.linesLock.Lock()
+	defer v.linesLock.Unlock()
 
-	status := ""
-	for _, k := range ks {
-		status += statusMap[k] + ", "
+	rows := make(map[int]bool)
+	mark := func(rs []Region) {
+		for _, r := range rs {
+			row1, _ := v.bv.RowCol(r.Begin())
+			row2, _ := v.bv.RowCol(r.End())
+			for row := row1; row <= row2; row++ {
+				rows[row] = true
+			}
+		}
 	}
-	v.Status = status
-}
+	mark(v.matches)
+	v.matches = matches
+	mark(v.matches)
 
-func (v *view) updateSelectionStatus() {
-	rs := v.Back().Sel().Regions()
-	if len(rs) > 1 {
-		v.SelectionStatus = fmt.Sprintf("%d selection regions", len(rs))
-		return
-	} else if len(rs) == 0 {
+	if v.FormattedLines == nil {
 		return
 	}
-	r := rs[0]
-	if !r.Empty() {
-		v.SelectionStatus = fmt.Sprintf("%d characters selected", r.End()-r.Begin())
-		return
+	for row := range rows {
+		if row < v.FormattedLines.len() {
+			v.formatLine(row, v.FormattedLines.get(row))
+		}
 	}
-	row, col := v.Back().RowCol(r.Begin())
-	v.SelectionStatus = fmt.Sprintf("Line %d, Column %d", row, col)
 }
@@ -8,22 +8,68 @@ import (
 	"sync"
 
 	"github.com/limetext/backend"
+	"github.com/limetext/backend/log"
 	"github.com/limetext/qml-go"
 )
 
 // A helper glue structure connecting the backend Window with the qml.Window
 type window struct {
-	bw     *backend.Window
-	qw     *qml.Window
-	views  map[*backend.View]*view
-	Status string
+	bw      *backend.Window
+	qw      *qml.Window
+	Status  string
+	Overlay *overlay
+	Find    *findPanel
+	// the find in files panel
+	FindInFiles *findInFiles
+
+	ConsoleVisible   bool
+	MinimapVisible   bool
+	StatusBarVisible bool
+
+	// the glue views of the backend views, they come and go on the
+	// goroutines of the backend events and of dropped tabs
+	viewsLock sync.Mutex
+	views     map[*backend.View]*view
+
+	// the views of each cell of the layout, see layout.go
+	groupsLock  sync.Mutex
+	layout      layout
+	groups      [][]*backend.View
+	activeGroup int
+
+	// guards Status and the toasts
+	notifyLock   sync.Mutex
+	statusExpiry int
+	toasts       []*notification
+	// ToastsVersion changes with the toasts to make qml call Toast again
+	ToastsLen     int
+	ToastsVersion int
+	// holds a token while a modal dialog of the window is open
+	dialogQueue chan struct{}
+	// the folder of the last file prompt
+	folderLock sync.Mutex
+	lastFolder string
+	// the files of the project for goto anything
+	indexLock sync.Mutex
+	index     *fileIndex
+
+	// geometry to launch the window with, used when restoring sessions
+	geometry *windowGeometry
 }
 
 func newWindow(bw *backend.Window) *window {
-	return &window{
-		bw:    bw,
-		views: make(map[*backend.View]*view),
+	w := &window{
+		bw:               bw,
+		views:            make(map[*backend.View]*view),
+		MinimapVisible:   true,
+		StatusBarVisible: true,
+		layout:           defaultLayout(),
+		groups:           make([][]*backend.View, 1),
+		dialogQueue:      make(chan struct{}, 1),
 	}
+	w.Find = newFindPanel(w)
+	w.FindInFiles = newFindInFiles(w)
+	return w
 }
 
 // Instantiates a new window, and launches a new goroutine waiting for it
@@ -31,7 +77,15 @@ func newWindow(bw *backend.Window) *window {
 // once the window closes.
 func (w *window) launch(wg *sync.WaitGroup, component qml.Object) {
 	wg.Add(1)
+	w.Overlay = newOverlay(component.Common().Engine())
 	w.qw = component.CreateWindow(nil)
+	if g := w.geometry; g != nil {
+		w.qw.Set("x", g.X)
+		w.qw.Set("y", g.Y)
+		w.qw.Set("width", g.Width)
+		w.qw.Set("height", g.Height)
+		w.geometry = nil
+	}
 	w.qw.Show()
 	w.qw.Set("myWindow", w)
 
@@ -41,6 +95,86 @@ func (w *window) launch(wg *sync.WaitGroup, component qml.Object) {
 	}()
 }
 
+// RequestClose is called from QML when the user closes the window, unsaved
+// changes are dealt with before the window actually goes away
+func (w *window) RequestClose() {
+	go func() {
+		// closing the last window is the same as quitting
+		last := len(fe.windowList()) == 1
+		if last && !fe.confirmQuit([]*backend.Window{w.bw}) {
+			return
+		}
+		if !last && !fe.confirmClose([]*backend.Window{w.bw}) {
+			return
+		}
+		if last {
+			if err := fe.saveSession(); err != nil {
+				log.Error("Couldn't save session: %s", err)
+			}
+		}
+		w.bw.Close()
+		fe.windowsLock.Lock()
+		delete(fe.windows, w.bw)
+		fe.windowsLock.Unlock()
+		if w.qw != nil {
+			w.qw.Hide()
+			w.qw.Destroy()
+			w.qw = nil
+		}
+	}()
+}
+
+// view returns the glue view of bv or nil if bv isn't in the window
+func (w *window) view(bv *backend.View) *view {
+	w.viewsLock.Lock()
+	defer w.viewsLock.Unlock()
+	return w.views[bv]
+}
+
+// setView makes v the glue view of bv
+func (w *window) setView(bv *backend.View, v *view) {
+	w.viewsLock.Lock()
+	w.views[bv] = v
+	w.viewsLock.Unlock()
+}
+
+// forgetView removes the glue view of bv from the window and returns it
+func (w *window) forgetView(bv *backend.View) *view {
+	w.viewsLock.Lock()
+	defer w.viewsLock.Unlock()
+	v := w.views[bv]
+	delete(w.views, bv)
+	return v
+}
+
+// viewMap returns a copy of the glue views of the window, which can be
+// ranged over while views open and close
+func (w *window) viewMap() map[*backend.View]*view {
+	w.viewsLock.Lock()
+	defer w.viewsLock.Unlock()
+	ret := make(map[*backend.View]*view, len(w.views))
+	for bv, v := range w.views {
+		ret[bv] = v
+	}
+	return ret
+}
+
+// raise brings the window to the front
+func (w *window) raise() {
+	if w.qw == nil {
+		return
+	}
+	w.qw.Call("raise")
+	w.qw.Call("requestActivate")
+}
+
+// setVisible shows or hides one of the window's toggleable parts, like the
+// console
+func (w *window) setVisible(field *bool, visible bool) {
+	*field = visible
+	fe.qmlChanged(w, field)
+}
+
 func (w *window) Back() *backend.Window {
 	return w.bw
 }